@@ -0,0 +1,20 @@
+//go:build linux
+// +build linux
+
+package splitter
+
+import (
+	"os"
+	"syscall"
+)
+
+// allocate reserves disk blocks for the file with fallocate(2) and falls back
+// to Truncate on filesystems that do not support it.
+func allocate(f *os.File, size int64) error {
+	err := syscall.Fallocate(int(f.Fd()), 0, 0, size)
+	if err == syscall.EOPNOTSUPP || err == syscall.ENOSYS {
+		return truncateAllocate(f, size)
+	}
+
+	return err
+}
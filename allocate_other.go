@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package splitter
+
+import (
+	"os"
+)
+
+// allocate extends the file to the size.
+func allocate(f *os.File, size int64) error {
+	return truncateAllocate(f, size)
+}
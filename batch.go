@@ -0,0 +1,319 @@
+package splitter
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// errOutputExists is the reason of entries skipped by Batch.SkipExisting.
+var errOutputExists = errors.New("output file exists")
+
+// A BatchEntry is a single download of an input list.
+type BatchEntry struct {
+	// Line is the line number of the URL in the input list.
+	Line int
+
+	URL string
+
+	// Out is the output file name relative to Dir. The name is resolved from
+	// the source if it is empty.
+	Out string
+
+	// Dir is the output directory. Batch.Dir is used if it is empty.
+	Dir string
+
+	Checksum *Checksum
+	Header   http.Header
+
+	// Err is the error in the options of the entry. Such entries are
+	// skipped.
+	Err error
+}
+
+// ParseBatch parses an input list in the aria2 format. Every URL starts at the
+// beginning of a line and may be followed by lines of "name=value" options
+// indented with spaces or tabs:
+//
+//	https://example.com/file.iso
+//	  out=debian.iso
+//	  dir=/tmp/images
+//	  checksum=sha-256=9f86d0...
+//	  header=Authorization: Bearer token
+//
+// Only the first of tab separated mirror URLs is used. Empty lines and lines
+// starting with "#" are ignored. Invalid options are reported in
+// BatchEntry.Err.
+func ParseBatch(r io.Reader) ([]*BatchEntry, error) {
+	var (
+		entries []*BatchEntry
+		entry   *BatchEntry
+	)
+
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		text := sc.Text()
+		trimmed := strings.TrimSpace(text)
+
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		if text[0] != ' ' && text[0] != '\t' {
+			entry = &BatchEntry{Line: line, URL: strings.Split(trimmed, "\t")[0]}
+			entries = append(entries, entry)
+
+			continue
+		}
+
+		if entry == nil {
+			return nil, fmt.Errorf("splitter: batch line %d: option without URL", line)
+		}
+
+		if err := entry.setOption(trimmed); err != nil && entry.Err == nil {
+			entry.Err = fmt.Errorf("line %d: %v", line, err)
+		}
+	}
+
+	if err := sc.Err(); err != nil {
+		return nil, &splitterError{context: "cannot read batch", err: err}
+	}
+
+	return entries, nil
+}
+
+// setOption applies the "name=value" option.
+func (be *BatchEntry) setOption(option string) error {
+	name, value, ok := cutPair(option)
+	if !ok {
+		return fmt.Errorf("invalid option %q", option)
+	}
+
+	switch name {
+	case "out":
+		be.Out = value
+	case "dir":
+		be.Dir = value
+	case "checksum":
+		c, err := ParseChecksum(value)
+		if err != nil {
+			return err
+		}
+
+		be.Checksum = c
+	case "header":
+		i := strings.IndexByte(value, ':')
+		if i <= 0 {
+			return fmt.Errorf("invalid header %q", value)
+		}
+
+		if be.Header == nil {
+			be.Header = http.Header{}
+		}
+
+		be.Header.Add(strings.TrimSpace(value[:i]), strings.TrimSpace(value[i+1:]))
+	default:
+		return fmt.Errorf("unknown option %q", name)
+	}
+
+	return nil
+}
+
+// BatchStatus is the outcome of a BatchEntry.
+type BatchStatus int
+
+// Batch statuses reported in BatchResult.
+const (
+	BatchSucceeded BatchStatus = iota
+	BatchFailed
+	BatchSkipped
+)
+
+var batchStatusNames = [...]string{
+	BatchSucceeded: "succeeded",
+	BatchFailed:    "failed",
+	BatchSkipped:   "skipped",
+}
+
+func (bs BatchStatus) String() string {
+	if bs < 0 || int(bs) >= len(batchStatusNames) {
+		return "unknown"
+	}
+
+	return batchStatusNames[bs]
+}
+
+// A BatchResult is the outcome of a BatchEntry.
+type BatchResult struct {
+	Entry  *BatchEntry
+	Status BatchStatus
+	Err    error
+}
+
+// A Batch downloads the entries of an input list with a Manager.
+type Batch struct {
+	Manager *Manager
+
+	// Dir is the output directory of entries without one. The current
+	// directory is used if it is empty.
+	Dir string
+
+	// SkipExisting skips entries with an output file that exists, is not
+	// empty and has no journal, i.e. was downloaded before. It applies only
+	// to entries with Out.
+	SkipExisting bool
+
+	// Configure is called with the Splitter of every entry before the
+	// download starts.
+	Configure func(*Splitter, *BatchEntry)
+
+	// Request customizes the requests of every entry. The headers of an
+	// entry replace the ones of Request with the same name.
+	Request *RequestOptions
+}
+
+// Run downloads the entries and returns their results in the same order.
+func (b *Batch) Run(entries []*BatchEntry) []BatchResult {
+	results := make([]BatchResult, len(entries))
+	jobs := make([]*Job, len(entries))
+
+	for i, e := range entries {
+		results[i] = BatchResult{Entry: e, Status: BatchSkipped, Err: e.Err}
+		if e.Err != nil {
+			continue
+		}
+
+		dest := b.dest(e)
+		if dest == "" {
+			results[i].Err = errOutputExists
+			continue
+		}
+
+		jobs[i] = b.job(e, dest)
+		b.Manager.Add(jobs[i])
+	}
+
+	_ = b.Manager.Wait()
+
+	for i, j := range jobs {
+		if j == nil {
+			continue
+		}
+
+		results[i].Status = BatchSucceeded
+		if b.Manager.State(j) != JobComplete {
+			results[i].Status = BatchFailed
+			results[i].Err = b.Manager.Err(j)
+		}
+	}
+
+	return results
+}
+
+// dest returns the destination of the entry for PathResolver: the output file
+// if the entry has Out or the output directory. It returns an empty path if
+// the entry is skipped.
+func (b *Batch) dest(e *BatchEntry) string {
+	dir := e.Dir
+	if dir == "" {
+		dir = b.Dir
+	}
+	if dir == "" {
+		dir = "."
+	}
+
+	if e.Out == "" {
+		return dir
+	}
+
+	p := filepath.Join(dir, e.Out)
+
+	if b.SkipExisting {
+		fi, err := os.Stat(p)
+		_, jErr := os.Stat(p + JournalSuffix)
+
+		if err == nil && fi.Size() > 0 && os.IsNotExist(jErr) {
+			return ""
+		}
+	}
+
+	return p
+}
+
+// job creates the Manager job of the entry.
+func (b *Batch) job(e *BatchEntry, dest string) *Job {
+	return &Job{
+		Source:   e.URL,
+		Dest:     dest,
+		DestFile: e.Out != "",
+		Request:  b.request(e),
+		Configure: func(s *Splitter) {
+			if e.Checksum != nil {
+				s.Checksum = e.Checksum
+			}
+
+			if b.Configure != nil {
+				b.Configure(s, e)
+			}
+		},
+	}
+}
+
+// request returns the options of the entry: Batch.Request with the headers of
+// the entry, which take precedence.
+func (b *Batch) request(e *BatchEntry) *RequestOptions {
+	if len(e.Header) == 0 {
+		return b.Request
+	}
+
+	ro := &RequestOptions{}
+	if b.Request != nil {
+		*ro = *b.Request
+	}
+
+	h := http.Header{}
+	for k, v := range ro.Header {
+		h[k] = v
+	}
+
+	for k, v := range e.Header {
+		h[k] = v
+	}
+
+	ro.Header = h
+
+	return ro
+}
+
+// WriteBatchSummary writes a line per result and the totals.
+func WriteBatchSummary(w io.Writer, results []BatchResult) error {
+	var counts [len(batchStatusNames)]int
+
+	for _, r := range results {
+		counts[r.Status]++
+
+		line := fmt.Sprintf("%-9s %s", r.Status, redactRawURL(r.Entry.URL))
+		if r.Err != nil {
+			line += ": " + r.Err.Error()
+		}
+
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+
+	_, err := fmt.Fprintf(
+		w,
+		"%d succeeded, %d failed, %d skipped\n",
+		counts[BatchSucceeded],
+		counts[BatchFailed],
+		counts[BatchSkipped],
+	)
+
+	return err
+}
@@ -0,0 +1,191 @@
+package splitter
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParseBatch(t *testing.T) {
+	input := `# manifest
+http://example.com/a.iso	http://mirror.example.com/a.iso
+  out=image.iso
+	dir=/tmp/images
+  checksum=sha-256=` + strings.Repeat("ab", 32) + `
+  header=Authorization: Bearer token
+  header=X-Trace: 1
+
+http://example.com/b.bin
+  unknown=1
+  out=b.bin
+`
+
+	entries, err := ParseBatch(strings.NewReader(input))
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	a := entries[0]
+	assert.Equal(t, 2, a.Line)
+	assert.Equal(t, "http://example.com/a.iso", a.URL)
+	assert.Equal(t, "image.iso", a.Out)
+	assert.Equal(t, "/tmp/images", a.Dir)
+	assert.Equal(t, SHA256, a.Checksum.Algorithm)
+	assert.Equal(t, "Bearer token", a.Header.Get("Authorization"))
+	assert.Equal(t, "1", a.Header.Get("X-Trace"))
+	assert.NoError(t, a.Err)
+
+	assert.EqualError(t, entries[1].Err, `line 10: unknown option "unknown"`)
+	assert.Equal(t, "b.bin", entries[1].Out)
+
+	_, err = ParseBatch(strings.NewReader("  out=a.bin\n"))
+	assert.EqualError(t, err, "splitter: batch line 1: option without URL")
+}
+
+func TestBatchRun(t *testing.T) {
+	dir, _ := initTmpStorage()
+	defer os.RemoveAll(dir)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte("remote content"))
+	}))
+	defer srv.Close()
+
+	src := filepath.Join(dir, "source.bin")
+	_ = ioutil.WriteFile(src, []byte("local content"), 0666)
+	_ = ioutil.WriteFile(filepath.Join(dir, "existing.bin"), []byte("done"), 0666)
+
+	sum := sha256.Sum256([]byte("local content"))
+
+	input := src + `
+  out=copy.bin
+  checksum=sha-256=` + hex.EncodeToString(sum[:]) + `
+` + src + `
+  out=LICENSE
+` + src + `
+  out=existing.bin
+` + srv.URL + `/remote.txt
+  out=remote.txt
+  header=Authorization: Bearer token
+` + srv.URL + `/denied.txt
+  out=denied.txt
+` + src + `
+  checksum=invalid
+`
+
+	entries, err := ParseBatch(strings.NewReader(input))
+	assert.NoError(t, err)
+
+	b := &Batch{
+		Manager:      NewManager(context.Background(), &http.Client{}, 2, 0, 0),
+		Dir:          dir,
+		SkipExisting: true,
+	}
+
+	results := b.Run(entries)
+
+	var statuses []BatchStatus
+	for _, r := range results {
+		statuses = append(statuses, r.Status)
+	}
+
+	assert.Equal(
+		t,
+		[]BatchStatus{BatchSucceeded, BatchSucceeded, BatchSkipped, BatchSucceeded, BatchFailed, BatchSkipped},
+		statuses,
+	)
+
+	copied, _ := ioutil.ReadFile(filepath.Join(dir, "copy.bin"))
+	assert.Equal(t, "local content", string(copied))
+
+	license, _ := ioutil.ReadFile(filepath.Join(dir, "LICENSE"))
+	assert.Equal(t, "local content", string(license))
+
+	remote, _ := ioutil.ReadFile(filepath.Join(dir, "remote.txt"))
+	assert.Equal(t, "remote content", string(remote))
+
+	var summary bytes.Buffer
+	assert.NoError(t, WriteBatchSummary(&summary, results))
+
+	lines := strings.Split(strings.TrimSpace(summary.String()), "\n")
+	assert.Len(t, lines, 7)
+	assert.Equal(t, "skipped   "+src+": output file exists", lines[2])
+	assert.Equal(t, "3 succeeded, 1 failed, 2 skipped", lines[6])
+}
+
+func TestBatchRequest(t *testing.T) {
+	dir, _ := initTmpStorage()
+	defer os.RemoveAll(dir)
+
+	cdn, _ := url.Parse("http://cdn.com/file.txt?sig=abc")
+	respond := rangeResponder("abcdefghijkl")
+
+	var (
+		mu       sync.Mutex
+		requests []*http.Request
+	)
+
+	client := funcClient(func(req *http.Request) (*http.Response, error) {
+		mu.Lock()
+		requests = append(requests, req)
+		mu.Unlock()
+
+		if req.Method == http.MethodHead {
+			return &http.Response{
+				StatusCode:    200,
+				Header:        http.Header{"Content-Type": {"text/plain"}},
+				ContentLength: 12,
+				Request:       &http.Request{URL: cdn},
+			}, nil
+		}
+
+		return respond(req)
+	})
+
+	entries, err := ParseBatch(strings.NewReader(`http://source.com/file.txt
+  out=file.txt
+  header=Authorization: Bearer token
+`))
+	assert.NoError(t, err)
+
+	b := &Batch{
+		Manager: NewManager(context.Background(), client, 2, 0, 0),
+		Dir:     dir,
+		Request: &RequestOptions{
+			Header:   http.Header{"Authorization": {"Bearer global"}, "X-Trace": {"1"}},
+			Username: "user",
+		},
+	}
+
+	results := b.Run(entries)
+	assert.Equal(t, BatchSucceeded, results[0].Status, results[0].Err)
+	assert.Len(t, requests, 3)
+
+	for _, req := range requests {
+		assert.Equal(t, "1", req.Header.Get("X-Trace"))
+
+		if req.URL.Host == "source.com" {
+			assert.Equal(t, "Bearer token", req.Header.Get("Authorization"))
+			continue
+		}
+
+		assert.Equal(t, "cdn.com", req.URL.Host)
+		assert.Empty(t, req.Header.Get("Authorization"))
+	}
+}
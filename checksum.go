@@ -0,0 +1,276 @@
+package splitter
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Digest algorithms supported by Checksum. The names follow the HTTP Digest
+// Algorithm Values registry.
+const (
+	SHA256 = "sha-256"
+	SHA512 = "sha-512"
+	SHA1   = "sha-1"
+	MD5    = "md5"
+	CRC32C = "crc32c"
+)
+
+// algorithms maps supported algorithms to their hash constructors.
+var algorithms = map[string]func() hash.Hash{
+	SHA256: sha256.New,
+	SHA512: sha512.New,
+	SHA1:   sha1.New,
+	MD5:    md5.New,
+	CRC32C: newCRC32C,
+}
+
+// newCRC32C creates new CRC-32 hash with the Castagnoli polynomial.
+func newCRC32C() hash.Hash {
+	return crc32.New(crc32.MakeTable(crc32.Castagnoli))
+}
+
+// algorithmAliases maps commonly used spellings to the algorithm names.
+var algorithmAliases = map[string]string{
+	"sha256": SHA256,
+	"sha512": SHA512,
+	"sha1":   SHA1,
+	"sha":    SHA1,
+}
+
+// A Checksum is an expected digest of the complete source.
+type Checksum struct {
+	Algorithm string
+	Sum       []byte
+}
+
+// ParseChecksum parses the "algorithm=value" or "algorithm:value" checksum
+// notation where value is either hex or base64 encoded, e.g.
+// "sha-256=9f86d0...". Algorithm names are case insensitive and may omit the
+// dash.
+func ParseChecksum(s string) (*Checksum, error) {
+	sep := strings.IndexAny(s, "=:")
+	if sep < 0 {
+		return nil, fmt.Errorf("splitter: invalid checksum %q", s)
+	}
+
+	algo := normalizeAlgorithm(s[:sep])
+	if _, ok := algorithms[algo]; !ok {
+		return nil, fmt.Errorf("splitter: unsupported checksum algorithm %q", s[:sep])
+	}
+
+	sum, err := decodeSum(algo, s[sep+1:])
+	if err != nil {
+		return nil, fmt.Errorf("splitter: invalid checksum %q: %v", s, err)
+	}
+
+	return &Checksum{Algorithm: algo, Sum: sum}, nil
+}
+
+func (c Checksum) String() string {
+	return c.Algorithm + "=" + hex.EncodeToString(c.Sum)
+}
+
+// VerificationError is returned by Download and Resume when the assembled
+// destination does not match the expected checksum.
+type VerificationError struct {
+	Algorithm string
+	Expected  []byte
+	Actual    []byte
+}
+
+func (ve *VerificationError) Error() string {
+	return fmt.Sprintf(
+		"splitter: verification failed: %s mismatch: expected %x, got %x",
+		ve.Algorithm,
+		ve.Expected,
+		ve.Actual,
+	)
+}
+
+// verifyChecksums reads r once and compares it with every checksum.
+func verifyChecksums(r io.Reader, checksums []Checksum) error {
+	v, err := newVerifier(checksums)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(v, r); err != nil {
+		return &splitterError{context: "cannot read destination", err: err}
+	}
+
+	return v.check()
+}
+
+// A verifier computes all checksums over the bytes written to it.
+type verifier struct {
+	checksums []Checksum
+	hashes    []hash.Hash
+	io.Writer
+}
+
+// newVerifier creates new verifier instance for the checksums.
+func newVerifier(checksums []Checksum) (*verifier, error) {
+	v := &verifier{checksums: checksums}
+	writers := make([]io.Writer, len(checksums))
+
+	for i, c := range checksums {
+		newHash, ok := algorithms[c.Algorithm]
+		if !ok {
+			return nil, fmt.Errorf("splitter: unsupported checksum algorithm %q", c.Algorithm)
+		}
+
+		v.hashes = append(v.hashes, newHash())
+		writers[i] = v.hashes[i]
+	}
+
+	v.Writer = io.MultiWriter(writers...)
+
+	return v, nil
+}
+
+// check compares the computed digests with the expected ones.
+func (v *verifier) check() error {
+	for i, c := range v.checksums {
+		if actual := v.hashes[i].Sum(nil); !bytes.Equal(actual, c.Sum) {
+			return &VerificationError{
+				Algorithm: c.Algorithm,
+				Expected:  c.Sum,
+				Actual:    actual,
+			}
+		}
+	}
+
+	return nil
+}
+
+// digestsFromHeader collects checksums of the complete source advertised in
+// the response headers: Repr-Digest (RFC 9530), Digest (RFC 3230),
+// Content-MD5 (full responses only) and the hash headers of Google Cloud
+// Storage, Amazon S3 and Artifactory.
+func digestsFromHeader(h http.Header, full bool) []Checksum {
+	var digests []Checksum
+
+	add := func(algo, value string) {
+		algo = normalizeAlgorithm(algo)
+		if _, ok := algorithms[algo]; !ok {
+			return
+		}
+
+		sum, err := decodeSum(algo, value)
+		if err != nil {
+			return
+		}
+
+		for _, d := range digests {
+			if d.Algorithm == algo {
+				return
+			}
+		}
+
+		digests = append(digests, Checksum{Algorithm: algo, Sum: sum})
+	}
+
+	for _, kv := range headerList(h, "Repr-Digest") {
+		if k, v, ok := cutPair(kv); ok {
+			add(k, strings.Trim(v, ":"))
+		}
+	}
+
+	for _, kv := range headerList(h, "Digest") {
+		if k, v, ok := cutPair(kv); ok {
+			add(k, v)
+		}
+	}
+
+	for _, kv := range headerList(h, "X-Goog-Hash") {
+		if k, v, ok := cutPair(kv); ok {
+			add(k, v)
+		}
+	}
+
+	for _, algo := range []string{SHA256, SHA1, CRC32C} {
+		name := "X-Amz-Checksum-" + strings.Replace(algo, "-", "", 1)
+		if v := h.Get(name); v != "" {
+			add(algo, v)
+		}
+	}
+
+	for _, algo := range []string{SHA256, SHA1, MD5} {
+		name := "X-Checksum-" + strings.Replace(algo, "-", "", 1)
+		if v := h.Get(name); v != "" {
+			add(algo, v)
+		}
+	}
+
+	if v := h.Get("Content-MD5"); v != "" && full {
+		add(MD5, v)
+	}
+
+	return digests
+}
+
+// headerList splits comma separated values of the header.
+func headerList(h http.Header, name string) []string {
+	var list []string
+
+	for _, v := range h[http.CanonicalHeaderKey(name)] {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+
+	return list
+}
+
+// cutPair splits "key=value" around the first equal sign.
+func cutPair(kv string) (key, value string, ok bool) {
+	i := strings.IndexByte(kv, '=')
+	if i < 0 {
+		return "", "", false
+	}
+
+	return strings.TrimSpace(kv[:i]), strings.TrimSpace(kv[i+1:]), true
+}
+
+// normalizeAlgorithm converts an algorithm name to the form used by Checksum.
+func normalizeAlgorithm(algo string) string {
+	algo = strings.ToLower(strings.TrimSpace(algo))
+	if a, ok := algorithmAliases[algo]; ok {
+		return a
+	}
+
+	return algo
+}
+
+// decodeSum decodes hex or base64 digest value and checks its length.
+func decodeSum(algo, value string) ([]byte, error) {
+	size := algorithms[algo]().Size()
+
+	if sum, err := hex.DecodeString(value); err == nil && len(sum) == size {
+		return sum, nil
+	}
+
+	sum, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sum) != size {
+		return nil, fmt.Errorf("%s digest must be %d bytes long", algo, size)
+	}
+
+	return sum, nil
+}
@@ -0,0 +1,110 @@
+package splitter
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/url"
+	"os"
+	"testing"
+)
+
+const abcSHA256 = "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+
+func TestParseChecksum(t *testing.T) {
+	sum := sha256.Sum256([]byte("abc"))
+
+	for _, s := range []string{
+		"sha-256=" + abcSHA256,
+		"SHA256:" + abcSHA256,
+		"sha-256=ungWv48Bz+pBQUDeXa4iI7ADYaOWF3qctBD/YfIAFa0=",
+	} {
+		c, err := ParseChecksum(s)
+		assert.NoError(t, err, s)
+		assert.Equal(t, &Checksum{Algorithm: SHA256, Sum: sum[:]}, c)
+	}
+
+	assert.Equal(t, "sha-256="+abcSHA256, Checksum{SHA256, sum[:]}.String())
+
+	for _, s := range []string{"", "sha-256", "whirlpool=00", "md5=abc"} {
+		_, err := ParseChecksum(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestDigestsFromHeader(t *testing.T) {
+	h := http.Header{
+		"Repr-Digest":           {"sha-256=:ungWv48Bz+pBQUDeXa4iI7ADYaOWF3qctBD/YfIAFa0=:"},
+		"Digest":                {"SHA-256=AAAA, unknown=1"},
+		"X-Goog-Hash":           {"crc32c=NCVSFw==,md5=kAFQmDzST7DWlj99KOF/cg=="},
+		"X-Amz-Checksum-Sha1":   {"qZk+NkcGgWq6PiVxeFDCbJzQ2J0="},
+		"Content-Md5":           {"kAFQmDzST7DWlj99KOF/cg=="},
+		"X-Checksum-Sha256":     {"ffff"},
+		"X-Amz-Checksum-Crc32c": {"NCVSFw=="},
+	}
+
+	var algos []string
+	for _, d := range digestsFromHeader(h, true) {
+		algos = append(algos, d.Algorithm)
+	}
+
+	assert.Equal(t, []string{SHA256, CRC32C, MD5, SHA1}, algos)
+}
+
+func TestSplitterVerifyChecksum(t *testing.T) {
+	dir, f := initTmpStorage()
+	defer os.RemoveAll(dir)
+
+	testURL, _ := url.ParseRequestURI("http://source.com/file.txt")
+	GetDoFunc = rangeResponder("abc")
+
+	s := NewSplitter(
+		context.Background(),
+		&PathInfo{Source: &Source{Path: testURL, Size: 3}, Dest: f},
+		2,
+		&mockClient{},
+	)
+
+	s.Checksum, _ = ParseChecksum("sha-256=" + abcSHA256)
+	assert.NoError(t, s.Download())
+
+	s.Checksum, _ = ParseChecksum("md5=00000000000000000000000000000000")
+	err := s.Download()
+
+	var ve *VerificationError
+	assert.True(t, errors.As(err, &ve))
+	assert.EqualError(
+		t,
+		err,
+		"splitter: verification failed: md5 mismatch: "+
+			"expected 00000000000000000000000000000000, "+
+			"got 900150983cd24fb0d6963f7d28e17f72",
+	)
+}
+
+func TestSplitterVerifySourceDigest(t *testing.T) {
+	dir, f := initTmpStorage()
+	defer os.RemoveAll(dir)
+
+	testURL, _ := url.ParseRequestURI("http://source.com/file.txt")
+	GetDoFunc = rangeResponder("abd")
+
+	crc, _ := ParseChecksum("crc32c=NCVSFw==")
+	src := &Source{Path: testURL, Size: 3, Digests: []Checksum{*crc}}
+
+	s := NewSplitter(
+		context.Background(),
+		&PathInfo{Source: src, Dest: f},
+		1,
+		&mockClient{},
+	)
+
+	var ve *VerificationError
+	assert.True(t, errors.As(s.Download(), &ve))
+	assert.Equal(t, CRC32C, ve.Algorithm)
+
+	s.IgnoreSourceDigests = true
+	assert.NoError(t, s.Download())
+}
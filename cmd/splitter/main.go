@@ -0,0 +1,440 @@
+// Command splitter downloads a file by chunks in parallel.
+//
+// Usage:
+//
+//	splitter [flags] URL
+//	splitter [flags] -i FILE
+//
+// The URL may be an http(s), ftp or file URL or a local path. Flags may follow
+// the URL. With -i the URLs are read from an input list in the aria2 format,
+// see splitter.ParseBatch, and downloaded into the -o directory. Otherwise -o
+// is the output file unless it is an existing directory or ends with a path
+// separator, in which case the file is named after the source.
+//
+// The exit code is 0 on success, 1 if the download failed, 2 on invalid
+// usage, 3 if the source or the destination cannot be resolved, 4 if the
+// checksum does not match, 5 if the source changed during the download and
+// 130 if the download was interrupted.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/AlexyAV/splitter"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Exit codes of the command.
+const (
+	exitOK            = 0
+	exitFailure       = 1
+	exitUsage         = 2
+	exitResolve       = 3
+	exitVerification  = 4
+	exitSourceChanged = 5
+	exitInterrupted   = 130
+)
+
+// options holds the parsed command line.
+type options struct {
+	chunks    int
+	workers   int
+	output    string
+	resume    bool
+	headers   headerFlag
+	request   *splitter.RequestOptions
+	checksum  *splitter.Checksum
+	limitRate int
+	retries   int
+	atomic    bool
+	quiet     bool
+	input     string
+	source    string
+}
+
+func main() {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sig
+		cancel()
+	}()
+
+	os.Exit(run(ctx, os.Args[1:], os.Stderr))
+}
+
+// run executes the command and returns its exit code.
+func run(ctx context.Context, args []string, stderr io.Writer) int {
+	opts, err := parseFlags(args, stderr)
+	if err == flag.ErrHelp {
+		return exitOK
+	}
+
+	if err != nil {
+		fmt.Fprintf(stderr, "splitter: %v\n", err)
+		return exitUsage
+	}
+
+	if opts.input != "" {
+		return batch(ctx, opts, stderr)
+	}
+
+	return download(ctx, opts, stderr)
+}
+
+// parseFlags parses the arguments. Flags are accepted before and after the
+// URL.
+func parseFlags(args []string, stderr io.Writer) (*options, error) {
+	opts := &options{}
+
+	fs := flag.NewFlagSet("splitter", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: splitter [flags] URL")
+		fmt.Fprintln(stderr, "       splitter [flags] -i FILE")
+		fs.PrintDefaults()
+	}
+
+	var (
+		checksum, limitRate, user, cookies, netrcFile string
+		netrc                                         bool
+	)
+
+	request := &splitter.RequestOptions{}
+
+	fs.IntVar(&opts.chunks, "n", 8, "number of chunks")
+	fs.IntVar(&opts.workers, "workers", 0, "number of parallel connections (default one per chunk)")
+	fs.StringVar(&opts.output, "o", ".", "output file or directory")
+	fs.BoolVar(&opts.resume, "continue", false, "continue an interrupted download")
+	fs.BoolVar(&opts.resume, "c", false, "shorthand for -continue")
+	fs.Var(&opts.headers, "H", `request header "Name: value", may be repeated`)
+	fs.StringVar(&user, "user", "", `Basic authentication credentials "user:password"`)
+	fs.BoolVar(&netrc, "netrc", false, "read credentials from $NETRC or ~/.netrc")
+	fs.StringVar(&netrcFile, "netrc-file", "", "read credentials from the .netrc file")
+	fs.StringVar(&request.BearerToken, "bearer", "", "Bearer authentication token")
+	fs.StringVar(&cookies, "cookies", "", "Netscape cookies.txt file with the cookies to send")
+	fs.StringVar(&request.UserAgent, "user-agent", "", "User-Agent header")
+	fs.StringVar(&request.Referer, "referer", "", "Referer header")
+	fs.StringVar(&checksum, "checksum", "", `expected checksum "algorithm=value", e.g. sha-256=...`)
+	fs.StringVar(&limitRate, "limit-rate", "", "bandwidth limit in bytes per second, K, M and G suffixes are allowed")
+	fs.IntVar(&opts.retries, "retries", 3, "number of retries of a failed chunk")
+	fs.BoolVar(&opts.atomic, "atomic", false, "download into a temporary file and rename it when complete")
+	fs.BoolVar(&opts.quiet, "q", false, "do not print the progress and the result")
+	fs.StringVar(&opts.input, "i", "", `input list of URLs, "-" for stdin; with -continue downloaded files are skipped`)
+
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+
+	switch {
+	case opts.input != "" && len(positional) != 0:
+		fs.Usage()
+		return nil, errors.New("URL cannot be used with -i")
+	case opts.input != "" && checksum != "":
+		return nil, errors.New("-checksum cannot be used with -i, use the checksum option of the input list")
+	case opts.input == "" && len(positional) != 1:
+		fs.Usage()
+		return nil, errors.New("exactly one URL is required")
+	case opts.input == "":
+		opts.source = positional[0]
+	}
+
+	if opts.chunks <= 0 {
+		return nil, errors.New("number of chunks must be positive")
+	}
+
+	if checksum != "" {
+		c, err := splitter.ParseChecksum(checksum)
+		if err != nil {
+			return nil, err
+		}
+
+		opts.checksum = c
+	}
+
+	request.Header = opts.headers.header
+	request.Username, request.Password = splitUser(user)
+	opts.request = request
+
+	if cookies != "" {
+		jar, err := loadCookies(cookies)
+		if err != nil {
+			return nil, err
+		}
+
+		request.Cookies = jar
+	}
+
+	if netrc || netrcFile != "" {
+		n, err := loadNetrc(netrcFile)
+		if err != nil {
+			return nil, err
+		}
+
+		request.Netrc = n
+	}
+
+	if limitRate != "" {
+		rate, err := parseSize(limitRate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -limit-rate %q", limitRate)
+		}
+
+		opts.limitRate = rate
+	}
+
+	return opts, nil
+}
+
+// download resolves the paths and downloads the source.
+func download(ctx context.Context, opts *options, stderr io.Writer) int {
+	client := &http.Client{}
+
+	pr := splitter.NewPathResolver(opts.source, opts.output, client)
+	pr.DestFile = outputFile(opts.output)
+	pr.Request = opts.request
+	pr.FTP = &splitter.FTPSource{Netrc: opts.request.Netrc}
+
+	pi, err := pr.PathInfo()
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitResolve
+	}
+
+	s := splitter.NewSplitter(ctx, pi, opts.chunks, client)
+	s.Workers = opts.workers
+	s.Checksum = opts.checksum
+	s.Atomic = opts.atomic
+
+	if opts.retries > 0 {
+		s.Retry = splitter.NewRetryPolicy(opts.retries+1, time.Second, 30*time.Second)
+	}
+
+	if opts.limitRate > 0 {
+		s.RateLimit = splitter.NewRateLimiter(opts.limitRate)
+	}
+
+	if !opts.quiet {
+		s.OnProgress = splitter.NewProgressBar(stderr, filepath.Base(pi.Dest.Name())).Render
+	}
+
+	if opts.resume {
+		err = s.Resume()
+	} else {
+		err = s.Download()
+	}
+
+	name := s.PI.Dest.Name()
+	_ = s.PI.Dest.Close()
+
+	if err != nil {
+		return failure(ctx, err, stderr)
+	}
+
+	if !opts.quiet {
+		fmt.Fprintf(stderr, "saved %s (%d bytes)\n", name, pi.Source.Size)
+	}
+
+	return exitOK
+}
+
+// batch downloads the entries of the input list and prints the summary.
+func batch(ctx context.Context, opts *options, stderr io.Writer) int {
+	entries, err := readBatch(opts.input)
+	if err != nil {
+		fmt.Fprintf(stderr, "splitter: %v\n", err)
+		return exitUsage
+	}
+
+	var limiter *splitter.RateLimiter
+	if opts.limitRate > 0 {
+		limiter = splitter.NewRateLimiter(opts.limitRate)
+	}
+
+	b := &splitter.Batch{
+		Manager:      splitter.NewManager(ctx, &http.Client{}, opts.chunks, 0, 0),
+		Dir:          opts.output,
+		Request:      opts.request,
+		SkipExisting: opts.resume,
+		Configure: func(s *splitter.Splitter, _ *splitter.BatchEntry) {
+			s.Workers = opts.workers
+			s.Atomic = opts.atomic
+			s.RateLimit = limiter
+
+			if opts.retries > 0 {
+				s.Retry = splitter.NewRetryPolicy(opts.retries+1, time.Second, 30*time.Second)
+			}
+		},
+	}
+
+	results := b.Run(entries)
+
+	failed := false
+	for _, r := range results {
+		failed = failed || r.Status == splitter.BatchFailed
+	}
+
+	if !opts.quiet || failed {
+		_ = splitter.WriteBatchSummary(stderr, results)
+	}
+
+	switch {
+	case ctx.Err() != nil:
+		fmt.Fprintln(stderr, "splitter: interrupted, run again with -continue to resume")
+		return exitInterrupted
+	case failed:
+		return exitFailure
+	}
+
+	return exitOK
+}
+
+// readBatch parses the input list from the file or stdin if the name is "-".
+func readBatch(name string) ([]*splitter.BatchEntry, error) {
+	if name == "-" {
+		return splitter.ParseBatch(os.Stdin)
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return splitter.ParseBatch(f)
+}
+
+// failure reports the download error and returns its exit code.
+func failure(ctx context.Context, err error, stderr io.Writer) int {
+	var ve *splitter.VerificationError
+
+	switch {
+	case ctx.Err() != nil:
+		fmt.Fprintln(stderr, "splitter: interrupted, run again with -continue to resume")
+		return exitInterrupted
+	case errors.As(err, &ve):
+		fmt.Fprintln(stderr, err)
+		return exitVerification
+	case errors.Is(err, splitter.ErrSourceChanged):
+		fmt.Fprintln(stderr, err)
+		return exitSourceChanged
+	}
+
+	fmt.Fprintln(stderr, err)
+
+	return exitFailure
+}
+
+// outputFile reports whether the output path names a file rather than a
+// directory: it does not end with a path separator and is not an existing
+// directory.
+func outputFile(output string) bool {
+	if strings.HasSuffix(output, "/") || strings.HasSuffix(output, string(filepath.Separator)) {
+		return false
+	}
+
+	fi, err := os.Stat(output)
+
+	return err != nil || !fi.IsDir()
+}
+
+// parseSize parses a byte count with an optional K, M or G binary suffix.
+func parseSize(s string) (int, error) {
+	mult := 1
+
+	switch strings.ToUpper(s[len(s)-1:]) {
+	case "K":
+		mult = 1 << 10
+	case "M":
+		mult = 1 << 20
+	case "G":
+		mult = 1 << 30
+	}
+
+	if mult > 1 {
+		s = s[:len(s)-1]
+	}
+
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+
+	return n * mult, nil
+}
+
+// headerFlag collects the repeated -H flags.
+type headerFlag struct {
+	header http.Header
+}
+
+func (hf *headerFlag) String() string {
+	return ""
+}
+
+func (hf *headerFlag) Set(v string) error {
+	i := strings.IndexByte(v, ':')
+	if i <= 0 {
+		return fmt.Errorf("invalid header %q", v)
+	}
+
+	if hf.header == nil {
+		hf.header = http.Header{}
+	}
+
+	hf.header.Add(strings.TrimSpace(v[:i]), strings.TrimSpace(v[i+1:]))
+
+	return nil
+}
+
+// splitUser splits the "user:password" credentials.
+func splitUser(user string) (string, string) {
+	if i := strings.IndexByte(user, ':'); i >= 0 {
+		return user[:i], user[i+1:]
+	}
+
+	return user, ""
+}
+
+// loadCookies reads the cookies.txt file.
+func loadCookies(name string) (http.CookieJar, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return splitter.LoadCookies(f)
+}
+
+// loadNetrc reads the .netrc file or the default one if the name is empty.
+func loadNetrc(name string) (*splitter.Netrc, error) {
+	if name == "" {
+		return splitter.DefaultNetrc()
+	}
+
+	return splitter.LoadNetrc(name)
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var content = strings.Repeat("0123456789abcdef", 256)
+
+func newServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Token") != "secret" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain")
+		http.ServeContent(w, r, "file.txt", time.Time{}, strings.NewReader(content))
+	}))
+}
+
+func TestRunDownload(t *testing.T) {
+	srv := newServer(t)
+	defer srv.Close()
+
+	dir, _ := ioutil.TempDir("", "splitter")
+	defer os.RemoveAll(dir)
+
+	sum := sha256.Sum256([]byte(content))
+	out := filepath.Join(dir, "out.txt")
+
+	var stderr bytes.Buffer
+	code := run(context.Background(), []string{
+		"-n", "4",
+		"-H", "X-Token: secret",
+		srv.URL + "/file.txt",
+		"-o", out,
+		"-checksum", "sha256=" + hex.EncodeToString(sum[:]),
+		"-limit-rate", "1M",
+	}, &stderr)
+
+	assert.Equal(t, exitOK, code, stderr.String())
+	assert.Contains(t, stderr.String(), "out.txt: 100.0% 4.0 KiB / 4.0 KiB")
+	assert.Contains(t, stderr.String(), "saved "+out)
+
+	data, _ := ioutil.ReadFile(out)
+	assert.Equal(t, content, string(data))
+}
+
+func TestRunRequestOptions(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, _ := r.BasicAuth()
+		cookie, _ := r.Cookie("session")
+
+		if user != "user" || password != "pa:ss" || cookie == nil || r.UserAgent() != "agent" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain")
+		http.ServeContent(w, r, "file.txt", time.Time{}, strings.NewReader(content))
+	}))
+	defer srv.Close()
+
+	dir, _ := ioutil.TempDir("", "splitter")
+	defer os.RemoveAll(dir)
+
+	cookies := filepath.Join(dir, "cookies.txt")
+	_ = ioutil.WriteFile(cookies, []byte("127.0.0.1\tFALSE\t/\tFALSE\t0\tsession\tabc\n"), 0666)
+
+	netrc := filepath.Join(dir, "netrc")
+	_ = ioutil.WriteFile(netrc, []byte("machine 127.0.0.1 login user password pa:ss\n"), 0600)
+
+	out := filepath.Join(dir, "out.txt")
+
+	var stderr bytes.Buffer
+	code := run(context.Background(), []string{
+		"-netrc-file", netrc,
+		"-cookies", cookies,
+		"-user-agent", "agent",
+		"-o", out,
+		srv.URL + "/file.txt",
+	}, &stderr)
+
+	assert.Equal(t, exitOK, code, stderr.String())
+
+	data, _ := ioutil.ReadFile(out)
+	assert.Equal(t, content, string(data))
+
+	stderr.Reset()
+	code = run(context.Background(), []string{
+		"-user", "user:pa:ss",
+		"-cookies", cookies,
+		"-user-agent", "agent",
+		"-o", out,
+		srv.URL + "/file.txt",
+	}, &stderr)
+
+	assert.Equal(t, exitOK, code, stderr.String())
+}
+
+func TestRunOutput(t *testing.T) {
+	srv := newServer(t)
+	defer srv.Close()
+
+	dir, _ := ioutil.TempDir("", "splitter")
+	defer os.RemoveAll(dir)
+
+	existing := filepath.Join(dir, "Makefile")
+	_ = ioutil.WriteFile(existing, nil, 0666)
+
+	outputTests := []struct {
+		output, dest string
+	}{
+		{filepath.Join(dir, "out"), filepath.Join(dir, "out")},
+		{existing, existing},
+		{dir, filepath.Join(dir, "file.txt")},
+		{filepath.Join(dir, "sub") + string(filepath.Separator), filepath.Join(dir, "sub", "file.txt")},
+	}
+
+	_ = os.Mkdir(filepath.Join(dir, "sub"), 0777)
+
+	for _, ot := range outputTests {
+		var stderr bytes.Buffer
+		code := run(context.Background(), []string{"-q", "-H", "X-Token: secret", "-o", ot.output, srv.URL + "/file.txt"}, &stderr)
+		assert.Equal(t, exitOK, code, stderr.String())
+
+		data, _ := ioutil.ReadFile(ot.dest)
+		assert.Equal(t, content, string(data), ot.output)
+	}
+}
+
+func TestRunExitCodes(t *testing.T) {
+	srv := newServer(t)
+	defer srv.Close()
+
+	dir, _ := ioutil.TempDir("", "splitter")
+	defer os.RemoveAll(dir)
+
+	url := srv.URL + "/file.txt"
+	out := filepath.Join(dir, "out.txt")
+
+	exitTests := []struct {
+		args []string
+		code int
+	}{
+		{[]string{}, exitUsage},
+		{[]string{"-n", "0", url}, exitUsage},
+		{[]string{"-unknown", url}, exitUsage},
+		{[]string{"-limit-rate", "fast", url}, exitUsage},
+		{[]string{"-cookies", filepath.Join(dir, "missing.txt"), url}, exitUsage},
+		{[]string{"-netrc-file", filepath.Join(dir, "missing"), url}, exitUsage},
+		{[]string{"-h"}, exitOK},
+		{[]string{"-o", out, url}, exitResolve},
+		{[]string{"-o", out, "-H", "X-Token: secret", "-checksum", "md5=" + strings.Repeat("0", 32), url}, exitVerification},
+	}
+
+	for _, et := range exitTests {
+		var stderr bytes.Buffer
+		assert.Equal(t, et.code, run(context.Background(), et.args, &stderr), et.args)
+	}
+}
+
+func TestRunInterrupted(t *testing.T) {
+	srv := newServer(t)
+	defer srv.Close()
+
+	dir, _ := ioutil.TempDir("", "splitter")
+	defer os.RemoveAll(dir)
+
+	out := filepath.Join(dir, "out.txt")
+	args := []string{"-H", "X-Token: secret", "-o", out, "-limit-rate", "1K", srv.URL + "/file.txt"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	assert.Equal(t, exitInterrupted, run(ctx, args, &stderr))
+	assert.Contains(t, stderr.String(), "-continue")
+
+	stderr.Reset()
+	args = append(args, "-continue", "-limit-rate", "0")
+	assert.Equal(t, exitOK, run(context.Background(), args, &stderr), stderr.String())
+
+	data, _ := ioutil.ReadFile(out)
+	assert.Equal(t, content, string(data))
+}
+
+func TestRunBatch(t *testing.T) {
+	srv := newServer(t)
+	defer srv.Close()
+
+	dir, _ := ioutil.TempDir("", "splitter")
+	defer os.RemoveAll(dir)
+
+	list := filepath.Join(dir, "list.txt")
+	_ = ioutil.WriteFile(list, []byte(srv.URL+"/file.txt\n  out=first.txt\n"+
+		srv.URL+"/file.txt\n  out=second.txt\n  header=X-Token: wrong\n"), 0666)
+
+	var stderr bytes.Buffer
+	code := run(context.Background(), []string{"-i", list, "-o", dir, "-H", "X-Token: secret"}, &stderr)
+
+	assert.Equal(t, exitFailure, code, stderr.String())
+	assert.Contains(t, stderr.String(), "1 succeeded, 1 failed, 0 skipped")
+
+	data, _ := ioutil.ReadFile(filepath.Join(dir, "first.txt"))
+	assert.Equal(t, content, string(data))
+
+	stderr.Reset()
+	code = run(context.Background(), []string{"-i", list, "-o", dir, "-continue"}, &stderr)
+
+	assert.Equal(t, exitFailure, code, stderr.String())
+	assert.Contains(t, stderr.String(), "0 succeeded, 1 failed, 1 skipped")
+
+	for _, args := range [][]string{
+		{"-i", list, srv.URL},
+		{"-i", list, "-checksum", "md5=" + strings.Repeat("0", 32)},
+		{"-i", filepath.Join(dir, "missing.txt")},
+	} {
+		assert.Equal(t, exitUsage, run(context.Background(), args, &stderr), args)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	for s, n := range map[string]int{"100": 100, "2k": 2048, "1M": 1 << 20, "1G": 1 << 30} {
+		size, err := parseSize(s)
+		assert.NoError(t, err)
+		assert.Equal(t, n, size)
+	}
+
+	_, err := parseSize("-1K")
+	assert.Error(t, err)
+}
@@ -0,0 +1,123 @@
+package splitter
+
+import (
+	"context"
+	"sync"
+)
+
+// A ConnLimiter caps the number of connections opened at once in total and
+// per host. A single ConnLimiter may be shared by several Splitter instances,
+// see Splitter.ConnLimit. Chunks waiting for a connection are served by the
+// priority of their Splitter and in the order of arrival within a priority.
+type ConnLimiter struct {
+	mu      sync.Mutex
+	max     int
+	perHost int
+	active  int
+	hosts   map[string]int
+	waiters []*connWaiter
+}
+
+// A connWaiter is a chunk waiting for a connection.
+type connWaiter struct {
+	host     string
+	priority int
+	ready    chan struct{}
+}
+
+// NewConnLimiter creates new ConnLimiter instance. Zero or negative limit
+// means unlimited connections.
+func NewConnLimiter(max, perHost int) *ConnLimiter {
+	return &ConnLimiter{max: max, perHost: perHost, hosts: map[string]int{}}
+}
+
+// acquire blocks until a connection to the host may be opened or the context
+// is done. It is safe to call on nil receiver.
+func (cl *ConnLimiter) acquire(ctx context.Context, host string, priority int) error {
+	if cl == nil {
+		return nil
+	}
+
+	w := &connWaiter{host: host, priority: priority, ready: make(chan struct{})}
+
+	cl.mu.Lock()
+	cl.waiters = append(cl.waiters, w)
+	cl.dispatch()
+	cl.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+	}
+
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		cl.releaseLocked(host)
+	default:
+		for i, cw := range cl.waiters {
+			if cw == w {
+				cl.waiters = append(cl.waiters[:i], cl.waiters[i+1:]...)
+				break
+			}
+		}
+	}
+
+	return ctx.Err()
+}
+
+// release returns the connection to the host. It is safe to call on nil
+// receiver.
+func (cl *ConnLimiter) release(host string) {
+	if cl == nil {
+		return
+	}
+
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	cl.releaseLocked(host)
+}
+
+// releaseLocked returns the connection and serves the waiters. cl.mu must be
+// held.
+func (cl *ConnLimiter) releaseLocked(host string) {
+	cl.active--
+	cl.hosts[host]--
+	if cl.hosts[host] <= 0 {
+		delete(cl.hosts, host)
+	}
+
+	cl.dispatch()
+}
+
+// dispatch grants connections to the waiters with the highest priority as
+// long as the limits allow. cl.mu must be held.
+func (cl *ConnLimiter) dispatch() {
+	for cl.max <= 0 || cl.active < cl.max {
+		next := -1
+
+		for i, w := range cl.waiters {
+			if cl.perHost > 0 && cl.hosts[w.host] >= cl.perHost {
+				continue
+			}
+
+			if next < 0 || w.priority > cl.waiters[next].priority {
+				next = i
+			}
+		}
+
+		if next < 0 {
+			return
+		}
+
+		w := cl.waiters[next]
+		cl.waiters = append(cl.waiters[:next], cl.waiters[next+1:]...)
+		cl.active++
+		cl.hosts[w.host]++
+		close(w.ready)
+	}
+}
@@ -0,0 +1,132 @@
+package splitter
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConnLimiterLimits(t *testing.T) {
+	cl := NewConnLimiter(2, 1)
+	ctx := context.Background()
+
+	assert.NoError(t, cl.acquire(ctx, "a", 0))
+	assert.NoError(t, cl.acquire(ctx, "b", 0))
+
+	granted := make(chan string, 2)
+	go func() {
+		_ = cl.acquire(ctx, "a", 0)
+		granted <- "a"
+	}()
+
+	select {
+	case <-granted:
+		t.Fatal("per-host limit exceeded")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	cl.release("b")
+
+	select {
+	case <-granted:
+		t.Fatal("per-host limit exceeded")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	cl.release("a")
+	assert.Equal(t, "a", <-granted)
+}
+
+func TestConnLimiterPriority(t *testing.T) {
+	cl := NewConnLimiter(1, 0)
+	ctx := context.Background()
+
+	assert.NoError(t, cl.acquire(ctx, "a", 0))
+
+	granted := make(chan int, 2)
+	for _, p := range []int{1, 5} {
+		go func(p int) {
+			_ = cl.acquire(ctx, "a", p)
+			granted <- p
+		}(p)
+	}
+
+	for {
+		cl.mu.Lock()
+		n := len(cl.waiters)
+		cl.mu.Unlock()
+
+		if n == 2 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	cl.release("a")
+	assert.Equal(t, 5, <-granted)
+
+	cl.release("a")
+	assert.Equal(t, 1, <-granted)
+}
+
+func TestConnLimiterCancel(t *testing.T) {
+	cl := NewConnLimiter(1, 0)
+	assert.NoError(t, cl.acquire(context.Background(), "a", 0))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+
+	assert.Equal(t, context.DeadlineExceeded, cl.acquire(ctx, "a", 0))
+	assert.Empty(t, cl.waiters)
+
+	var nilLimiter *ConnLimiter
+	assert.NoError(t, nilLimiter.acquire(ctx, "a", 0))
+	nilLimiter.release("a")
+}
+
+func TestSplitterConnLimitFinalURL(t *testing.T) {
+	dir, f := initTmpStorage()
+	defer os.RemoveAll(dir)
+
+	path, _ := url.Parse("http://source.com/file.txt")
+	cdn, _ := url.Parse("http://cdn.com/file.txt")
+	respond := rangeResponder("abcdefghijkl")
+	cl := NewConnLimiter(0, 1)
+
+	var (
+		mu    sync.Mutex
+		hosts []map[string]int
+	)
+
+	GetDoFunc = func(req *http.Request) (*http.Response, error) {
+		cl.mu.Lock()
+		counted := map[string]int{}
+		for h, n := range cl.hosts {
+			counted[h] = n
+		}
+		cl.mu.Unlock()
+
+		mu.Lock()
+		hosts = append(hosts, counted)
+		mu.Unlock()
+
+		return respond(req)
+	}
+
+	src := &Source{Path: path, FinalURL: cdn, Size: 12}
+	s := NewSplitter(context.Background(), &PathInfo{Source: src, Dest: f}, 3, &mockClient{})
+	s.ConnLimit = cl
+
+	assert.NoError(t, s.Download())
+	assert.Len(t, hosts, 3)
+
+	for _, counted := range hosts {
+		assert.Equal(t, 1, counted["cdn.com"])
+		assert.Zero(t, counted["source.com"])
+	}
+}
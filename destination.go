@@ -0,0 +1,196 @@
+package splitter
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+// A Destination receives the bytes of the downloaded chunks. Chunks are written
+// concurrently, so WriteAt must be safe for parallel calls with distinct
+// offsets.
+//
+// A Destination may also implement the following optional methods:
+//
+//	Truncate(size int64) error  // called with zero before Download
+//	Sync() error                // called after all chunks are written
+//	Size() (int64, error)       // used by Resume without a journal
+//	ReadAt(p []byte, off int64) (int, error) // used for verification
+//
+// A Destination that does not implement ReadAt is not verified against
+// checksums. The journal, Atomic, Preallocate and CheckSpace require a file
+// destination, i.e. *os.File or *FileDestination.
+type Destination interface {
+	io.WriterAt
+}
+
+// truncater is the optional Destination method used by Download.
+type truncater interface {
+	Truncate(size int64) error
+}
+
+// syncer is the optional Destination method used after download.
+type syncer interface {
+	Sync() error
+}
+
+// sizer is the optional Destination method used by Resume.
+type sizer interface {
+	Size() (int64, error)
+}
+
+// errNoFile is returned for options that require a file destination.
+var errNoFile = errors.New("destination is not a file")
+
+// A FileDestination is a Destination backed by a file.
+type FileDestination struct {
+	*os.File
+}
+
+// NewFileDestination creates new FileDestination instance for the file.
+func NewFileDestination(f *os.File) *FileDestination {
+	return &FileDestination{File: f}
+}
+
+// Size returns the current size of the file.
+func (fd *FileDestination) Size() (int64, error) {
+	fi, err := fd.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	return fi.Size(), nil
+}
+
+// A Buffer is an in-memory Destination. It grows as chunks are written and
+// implements io.ReaderAt for the downloaded content.
+type Buffer struct {
+	mu  sync.RWMutex
+	buf []byte
+}
+
+// NewBuffer creates new Buffer instance with the capacity for size bytes.
+func NewBuffer(size int) *Buffer {
+	return &Buffer{buf: make([]byte, 0, size)}
+}
+
+// WriteAt writes p at the offset off and grows the buffer if needed.
+func (b *Buffer) WriteAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, os.ErrInvalid
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if end := int(off) + len(p); end > len(b.buf) {
+		b.grow(end)
+	}
+
+	return copy(b.buf[off:], p), nil
+}
+
+// ReadAt reads len(p) bytes from the offset off.
+func (b *Buffer) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, os.ErrInvalid
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if off >= int64(len(b.buf)) {
+		return 0, io.EOF
+	}
+
+	n := copy(p, b.buf[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+// Truncate changes the size of the buffer. New bytes are zero.
+func (b *Buffer) Truncate(size int64) error {
+	if size < 0 {
+		return os.ErrInvalid
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if int(size) > len(b.buf) {
+		b.grow(int(size))
+		return nil
+	}
+
+	b.buf = b.buf[:size]
+
+	return nil
+}
+
+// Size returns the size of the buffer.
+func (b *Buffer) Size() (int64, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return int64(len(b.buf)), nil
+}
+
+// Bytes returns the content of the buffer. The slice is valid until the next
+// write.
+func (b *Buffer) Bytes() []byte {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.buf
+}
+
+// grow extends the buffer to size bytes. b.mu must be held.
+func (b *Buffer) grow(size int) {
+	if size <= cap(b.buf) {
+		n := len(b.buf)
+		b.buf = b.buf[:size]
+		for i := n; i < size; i++ {
+			b.buf[i] = 0
+		}
+
+		return
+	}
+
+	buf := make([]byte, size, 2*size)
+	copy(buf, b.buf)
+	b.buf = buf
+}
+
+// destFile returns the file behind the destination or nil.
+func destFile(d Destination) *os.File {
+	switch d := d.(type) {
+	case *os.File:
+		return d
+	case *FileDestination:
+		return d.File
+	}
+
+	return nil
+}
+
+// destSize returns the current size of the destination or zero if it is
+// unknown.
+func destSize(d Destination) (int64, error) {
+	switch d := d.(type) {
+	case sizer:
+		return d.Size()
+	case interface{ Stat() (os.FileInfo, error) }:
+		fi, err := d.Stat()
+		if err != nil {
+			return 0, err
+		}
+
+		return fi.Size(), nil
+	}
+
+	return 0, nil
+}
@@ -0,0 +1,142 @@
+package splitter
+
+import (
+	"context"
+	"crypto/sha256"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestBuffer(t *testing.T) {
+	b := NewBuffer(0)
+
+	_, err := b.WriteAt([]byte("def"), 3)
+	assert.NoError(t, err)
+	_, err = b.WriteAt([]byte("abc"), 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "abcdef", string(b.Bytes()))
+
+	p := make([]byte, 4)
+	n, err := b.ReadAt(p, 4)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, "ef", string(p[:n]))
+
+	assert.NoError(t, b.Truncate(2))
+	assert.NoError(t, b.Truncate(4))
+	assert.Equal(t, "ab\x00\x00", string(b.Bytes()))
+
+	size, err := b.Size()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), size)
+
+	_, err = b.WriteAt([]byte("x"), -1)
+	assert.Error(t, err)
+}
+
+func TestBufferConcurrentWrites(t *testing.T) {
+	b := NewBuffer(0)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, _ = b.WriteAt([]byte{byte('0' + i)}, int64(i))
+		}(i)
+	}
+
+	wg.Wait()
+	assert.Equal(t, "0123456789", string(b.Bytes()))
+}
+
+func TestFileDestinationSize(t *testing.T) {
+	dir, f := initTmpStorage()
+	defer os.RemoveAll(dir)
+	_, _ = f.WriteString("abc")
+
+	size, err := NewFileDestination(f).Size()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), size)
+	assert.Equal(t, f, destFile(NewFileDestination(f)))
+	assert.Nil(t, destFile(NewBuffer(0)))
+}
+
+func TestSplitterDownloadToBuffer(t *testing.T) {
+	testURL, _ := url.ParseRequestURI("http://source.com/file.txt")
+	GetDoFunc = rangeResponder("abcdefghijkl")
+
+	sum := sha256.Sum256([]byte("abcdefghijkl"))
+	b := NewBuffer(0)
+	_, _ = b.WriteAt([]byte("stale content"), 0)
+
+	s := NewSplitter(
+		context.Background(),
+		&PathInfo{Source: &Source{Path: testURL, Size: 12}},
+		3,
+		&mockClient{},
+	)
+	s.Destination = b
+	s.Checksum = &Checksum{Algorithm: SHA256, Sum: sum[:]}
+
+	assert.NoError(t, s.Download())
+	assert.Equal(t, "abcdefghijkl", string(b.Bytes()))
+}
+
+func TestSplitterResumeBuffer(t *testing.T) {
+	testURL, _ := url.ParseRequestURI("http://source.com/file.txt")
+	respond := rangeResponder("abcdef")
+
+	var ranges []string
+	GetDoFunc = func(req *http.Request) (*http.Response, error) {
+		ranges = append(ranges, req.Header.Get("Range"))
+		return respond(req)
+	}
+
+	b := NewBuffer(6)
+	_, _ = b.WriteAt([]byte("abc"), 0)
+
+	s := NewSplitter(
+		context.Background(),
+		&PathInfo{Source: &Source{Path: testURL, Size: 6}},
+		1,
+		&mockClient{},
+	)
+	s.Destination = b
+
+	assert.NoError(t, s.Resume())
+	assert.Equal(t, []string{"bytes=3-5"}, ranges)
+	assert.Equal(t, "abcdef", string(b.Bytes()))
+}
+
+func TestSplitterDestinationRequiresFile(t *testing.T) {
+	testURL, _ := url.ParseRequestURI("http://source.com/file.txt")
+
+	s := NewSplitter(
+		context.Background(),
+		&PathInfo{Source: &Source{Path: testURL, Size: 6}},
+		1,
+		&mockClient{},
+	)
+	s.Destination = NewBuffer(0)
+	s.Atomic = true
+
+	assert.EqualError(
+		t,
+		s.Download(),
+		"splitter: cannot use temporary file: destination is not a file",
+	)
+
+	s.Atomic = false
+	s.CheckSpace = true
+
+	assert.EqualError(
+		t,
+		s.Download(),
+		"splitter: cannot reserve space: destination is not a file",
+	)
+}
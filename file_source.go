@@ -0,0 +1,101 @@
+package splitter
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// A FileSource is a RangeSource for file:// URLs. Every range is read with
+// ReadAt from its own file handle, so copies from network mounts are done in
+// parallel.
+type FileSource struct{}
+
+// Probe fetches the size of the file. Its modification time is used as the
+// LastModified validator.
+func (fs *FileSource) Probe(ctx context.Context, src *Source) error {
+	p := filePath(src.Path)
+
+	fi, err := os.Stat(p)
+	if err != nil {
+		return &SourceError{context: "cannot fetch source info", err: err}
+	}
+
+	if !fi.Mode().IsRegular() {
+		return &SourceError{
+			context: "cannot fetch source info",
+			err:     fmt.Errorf("%s is not a regular file", p),
+		}
+	}
+
+	if fi.Size() <= 0 {
+		return &SourceError{context: "cannot fetch content length"}
+	}
+
+	src.Size = int(fi.Size())
+	src.AcceptRanges = true
+	src.Ext = path.Ext(src.Path.Path)
+	src.LastModified = fi.ModTime().UTC().Format(http.TimeFormat)
+	src.FinalURL = src.Path
+
+	return nil
+}
+
+// OpenRange opens the file and returns a reader of the range.
+func (fs *FileSource) OpenRange(ctx context.Context, src *Source, dr DownloadRange) (io.ReadCloser, error) {
+	f, err := os.Open(filePath(src.Path))
+	if err != nil {
+		return nil, &splitterError{context: "chunk download error", err: err}
+	}
+
+	return &fileRangeReader{
+		Reader: io.NewSectionReader(f, int64(dr.Start), int64(dr.End-dr.Start)),
+		f:      f,
+	}, nil
+}
+
+// A fileRangeReader reads a section of the file and closes it.
+type fileRangeReader struct {
+	io.Reader
+	f *os.File
+}
+
+func (fr *fileRangeReader) Close() error {
+	return fr.f.Close()
+}
+
+// fileURL converts the local path to a file:// URL.
+func fileURL(p string) (*url.URL, error) {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return nil, err
+	}
+
+	abs = filepath.ToSlash(abs)
+	if !strings.HasPrefix(abs, "/") {
+		abs = "/" + abs
+	}
+
+	return &url.URL{Scheme: "file", Path: abs}, nil
+}
+
+// filePath converts the file:// URL to a local path. A host other than
+// localhost is kept as a UNC prefix.
+func filePath(u *url.URL) string {
+	p := u.Path
+
+	if u.Host != "" && u.Host != "localhost" {
+		p = "//" + u.Host + p
+	} else if len(p) > 2 && p[0] == '/' && p[2] == ':' {
+		// Drop the slash before a Windows drive letter, e.g. "/C:/dir".
+		p = p[1:]
+	}
+
+	return filepath.FromSlash(p)
+}
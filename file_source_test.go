@@ -0,0 +1,68 @@
+package splitter
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileSourceCopy(t *testing.T) {
+	dir, f := initTmpStorage()
+	defer os.RemoveAll(dir)
+
+	content := strings.Repeat("0123456789", 100)
+	src := filepath.Join(dir, "source.bin")
+	_ = ioutil.WriteFile(src, []byte(content), 0666)
+
+	for _, source := range []string{src, "file://" + filepath.ToSlash(src)} {
+		pi, err := NewPathResolver(source, f.Name(), nil).PathInfo()
+		assert.NoError(t, err)
+		assert.Equal(t, len(content), pi.Source.Size)
+		assert.Equal(t, ".bin", pi.Source.Ext)
+		assert.NotEmpty(t, pi.Source.LastModified)
+
+		s := NewSplitter(context.Background(), pi, 4, nil)
+		assert.NoError(t, s.Download())
+
+		copied, _ := ioutil.ReadFile(f.Name())
+		assert.Equal(t, content, string(copied))
+	}
+}
+
+func TestFileSourceProbeError(t *testing.T) {
+	dir, _ := initTmpStorage()
+	defer os.RemoveAll(dir)
+
+	u, _ := fileURL(dir)
+	_, err := NewBackendSource(u, &FileSource{})
+	assert.EqualError(
+		t,
+		err,
+		"splitter: source: cannot fetch source info: "+dir+" is not a regular file",
+	)
+
+	u, _ = fileURL(filepath.Join(dir, "missing.bin"))
+	_, err = NewBackendSource(u, &FileSource{})
+	assert.Error(t, err)
+}
+
+func TestFilePath(t *testing.T) {
+	pathTests := []struct {
+		url, path string
+	}{
+		{"file:///tmp/file.bin", "/tmp/file.bin"},
+		{"file://localhost/tmp/file.bin", "/tmp/file.bin"},
+		{"file:///C:/dir/file.bin", "C:/dir/file.bin"},
+		{"file://server/share/file.bin", "//server/share/file.bin"},
+	}
+
+	for _, pt := range pathTests {
+		u, _ := url.Parse(pt.url)
+		assert.Equal(t, filepath.FromSlash(pt.path), filePath(u), pt.url)
+	}
+}
@@ -0,0 +1,95 @@
+package splitter
+
+import (
+	"mime"
+	"path"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxFileName is the longest file name in bytes most filesystems accept.
+const maxFileName = 255
+
+// reservedNames are the device names Windows does not allow as file names,
+// even with an extension.
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// dispositionFileName returns the sanitized file name of the
+// Content-Disposition header value as defined by RFC 6266. The RFC 5987
+// encoded filename* parameter takes precedence over filename. It returns an
+// empty string if the header holds no usable name.
+func dispositionFileName(cd string) string {
+	if cd == "" {
+		return ""
+	}
+
+	// Both parameters are decoded into "filename", filename* wins.
+	_, params, err := mime.ParseMediaType(cd)
+	if err != nil {
+		return ""
+	}
+
+	return sanitizeFileName(params["filename"])
+}
+
+// sanitizeFileName makes the name suggested by a server safe to create in the
+// destination directory: directories are stripped, so the name cannot
+// traverse out of it, characters that are illegal on common filesystems are
+// replaced with "_", leading and trailing dots and spaces are trimmed, Windows
+// device names are prefixed with "_" and the name is shortened to 255 bytes
+// keeping its extension. It returns an empty string if nothing is left.
+func sanitizeFileName(name string) string {
+	name = path.Base(strings.Replace(name, `\`, "/", -1))
+
+	name = strings.Map(func(r rune) rune {
+		if r == utf8.RuneError || unicode.IsControl(r) || strings.ContainsRune(`<>:"/\|?*`, r) {
+			return '_'
+		}
+
+		return r
+	}, name)
+
+	name = strings.Trim(name, ". ")
+	if name == "" {
+		return ""
+	}
+
+	base := name
+	if i := strings.IndexByte(base, '.'); i >= 0 {
+		base = base[:i]
+	}
+
+	if reservedNames[strings.ToUpper(strings.TrimRight(base, " "))] {
+		name = "_" + name
+	}
+
+	return truncateFileName(name, maxFileName)
+}
+
+// truncateFileName shortens the name to n bytes at a rune boundary, keeping
+// its extension if it is short enough.
+func truncateFileName(name string, n int) string {
+	if len(name) <= n {
+		return name
+	}
+
+	ext := path.Ext(name)
+	if len(ext) > n/2 {
+		ext = ""
+	}
+
+	base := name[:len(name)-len(ext)]
+	for len(base)+len(ext) > n {
+		_, size := utf8.DecodeLastRuneInString(base)
+		base = base[:len(base)-size]
+	}
+
+	return base + ext
+}
@@ -0,0 +1,52 @@
+package splitter
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestDispositionFileName(t *testing.T) {
+	dispositionTests := []struct {
+		header, name string
+	}{
+		{`attachment; filename="report.pdf"`, "report.pdf"},
+		{`attachment; filename=report.pdf`, "report.pdf"},
+		{`inline; filename="fallback.txt"; filename*=UTF-8''%E2%82%AC%20rates.txt`, "€ rates.txt"},
+		{`attachment; filename*=utf-8''na%C3%AFve.zip`, "naïve.zip"},
+		{`attachment; filename="../../etc/passwd"`, "passwd"},
+		{`attachment; filename="C:\\Windows\\win.ini"`, "win.ini"},
+		{`attachment; filename=".."`, ""},
+		{`attachment`, ""},
+		{`attachment; filename="unterminated`, ""},
+		{``, ""},
+	}
+
+	for _, dt := range dispositionTests {
+		assert.Equal(t, dt.name, dispositionFileName(dt.header), dt.header)
+	}
+}
+
+func TestSanitizeFileName(t *testing.T) {
+	sanitizeTests := []struct {
+		name, sanitized string
+	}{
+		{"report.pdf", "report.pdf"},
+		{"a<b>c:d\"e|f?g*h.txt", "a_b_c_d_e_f_g_h.txt"},
+		{"tab\there\x00.txt", "tab_here_.txt"},
+		{" .hidden. ", "hidden"},
+		{"dir/sub/file.bin", "file.bin"},
+		{"CON", "_CON"},
+		{"nul.tar.gz", "_nul.tar.gz"},
+		{"console.log", "console.log"},
+		{"...", ""},
+	}
+
+	for _, st := range sanitizeTests {
+		assert.Equal(t, st.sanitized, sanitizeFileName(st.name), st.name)
+	}
+
+	long := sanitizeFileName(strings.Repeat("é", 200) + ".tar")
+	assert.True(t, len(long) <= maxFileName)
+	assert.True(t, strings.HasSuffix(long, "é.tar"))
+}
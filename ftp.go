@@ -0,0 +1,385 @@
+package splitter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ftpAcceptTimeout limits the wait for the server to open the data connection
+// in active mode, e.g. when a firewall drops it.
+const ftpAcceptTimeout = 30 * time.Second
+
+// errFTPLineBreak is returned for URLs that would inject commands into the
+// control connection.
+var errFTPLineBreak = errors.New("line break in URL path or credentials")
+
+// An FTPSource is a RangeSource for ftp:// URLs. The size is fetched with SIZE
+// and every range is downloaded over its own control and data connection
+// starting at the range offset with REST. Credentials are taken from the URL
+// or Netrc, anonymous login is used otherwise.
+type FTPSource struct {
+	// Active makes the server connect to the client for data transfers
+	// (PORT/EPRT). Passive mode (EPSV/PASV) is used otherwise.
+	Active bool
+
+	// Dialer is used for control and passive data connections. The zero
+	// net.Dialer is used if it is nil.
+	Dialer *net.Dialer
+
+	// Netrc provides the credentials of URLs without user info.
+	Netrc *Netrc
+}
+
+// Probe fetches the size of the file with SIZE and its modification time
+// with MDTM, which is used as the LastModified validator if the server
+// supports it.
+func (fs *FTPSource) Probe(ctx context.Context, src *Source) error {
+	c, err := fs.dial(ctx, src.Path)
+	if err != nil {
+		return &SourceError{context: "cannot fetch source info", err: err}
+	}
+	defer c.close()
+
+	_, msg, err := c.cmd(213, "SIZE %s", ftpPath(src.Path))
+	if err != nil {
+		return &SourceError{context: "cannot fetch content length", err: err}
+	}
+
+	size, err := strconv.Atoi(strings.TrimSpace(msg))
+	if err != nil || size <= 0 {
+		return &SourceError{
+			context: "cannot fetch content length",
+			err:     fmt.Errorf("invalid SIZE reply %q", msg),
+		}
+	}
+
+	src.Size = size
+	src.AcceptRanges = true
+	src.Ext = path.Ext(src.Path.Path)
+	src.FinalURL = src.Path
+
+	if _, msg, err := c.cmd(213, "MDTM %s", ftpPath(src.Path)); err == nil {
+		src.LastModified = strings.TrimSpace(msg)
+	}
+
+	return nil
+}
+
+// OpenRange retrieves the file from the range start with REST and RETR. The
+// returned reader stops after the range length.
+func (fs *FTPSource) OpenRange(ctx context.Context, src *Source, dr DownloadRange) (io.ReadCloser, error) {
+	c, err := fs.dial(ctx, src.Path)
+	if err != nil {
+		return nil, &splitterError{context: "chunk download error", err: err}
+	}
+
+	data, err := fs.retrieve(ctx, c, src.Path, dr)
+	if err != nil {
+		c.close()
+		return nil, err
+	}
+
+	r := &ftpReader{
+		Reader: io.LimitReader(data, int64(dr.End-dr.Start)),
+		data:   data,
+		ctrl:   c,
+		done:   make(chan struct{}),
+	}
+
+	go r.watch(ctx)
+
+	return r, nil
+}
+
+// retrieve opens the data connection and starts the transfer at the range
+// start.
+func (fs *FTPSource) retrieve(ctx context.Context, c *ftpConn, u *url.URL, dr DownloadRange) (net.Conn, error) {
+	var (
+		data net.Conn
+		ln   net.Listener
+		err  error
+	)
+
+	if fs.Active {
+		ln, err = c.port()
+	} else {
+		data, err = c.passive(ctx, fs.dialer())
+	}
+	if err != nil {
+		return nil, &splitterError{context: "cannot open data connection", err: err}
+	}
+
+	closeData := func() {
+		if data != nil {
+			_ = data.Close()
+		}
+		if ln != nil {
+			_ = ln.Close()
+		}
+	}
+
+	if dr.Start > 0 {
+		if _, _, err := c.cmd(350, "REST %d", dr.Start); err != nil {
+			closeData()
+			return nil, &ResponseError{
+				Range:  dr,
+				Reason: ErrRangeNotSupported.Error(),
+				err:    ErrRangeNotSupported,
+			}
+		}
+	}
+
+	if _, _, err := c.cmd(1, "RETR %s", ftpPath(u)); err != nil {
+		closeData()
+		return nil, &splitterError{context: "chunk download error", err: err}
+	}
+
+	if ln != nil {
+		data, err = accept(ctx, ln)
+		_ = ln.Close()
+		if err != nil {
+			return nil, &splitterError{context: "cannot open data connection", err: err}
+		}
+	}
+
+	return data, nil
+}
+
+// accept waits for the server to connect to the listener. The wait ends when
+// the context is canceled or after ftpAcceptTimeout.
+func accept(ctx context.Context, ln net.Listener) (net.Conn, error) {
+	if tl, ok := ln.(*net.TCPListener); ok {
+		_ = tl.SetDeadline(time.Now().Add(ftpAcceptTimeout))
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = ln.Close()
+		case <-done:
+		}
+	}()
+
+	conn, err := ln.Accept()
+	if err != nil && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	return conn, err
+}
+
+// dial connects to the server of the URL and logs in. URLs with a line break
+// in the path or the credentials are rejected, because the decoded values are
+// sent as command arguments.
+func (fs *FTPSource) dial(ctx context.Context, u *url.URL) (*ftpConn, error) {
+	user, pass := "anonymous", "anonymous@"
+	if u.User != nil {
+		user = u.User.Username()
+		pass, _ = u.User.Password()
+	} else if login, password, ok := fs.Netrc.Credentials(u.Hostname()); ok {
+		user, pass = login, password
+	}
+
+	for _, arg := range []string{ftpPath(u), user, pass} {
+		if strings.ContainsAny(arg, "\r\n") {
+			return nil, errFTPLineBreak
+		}
+	}
+
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "21")
+	}
+
+	conn, err := fs.dialer().DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &ftpConn{conn: conn, text: textproto.NewConn(conn)}
+
+	if _, _, err := c.text.ReadResponse(220); err != nil {
+		c.close()
+		return nil, err
+	}
+
+	code, _, err := c.cmd(0, "USER %s", user)
+	if err == nil && code == 331 {
+		_, _, err = c.cmd(230, "PASS %s", pass)
+	} else if err == nil && code != 230 {
+		err = fmt.Errorf("unexpected USER reply %d", code)
+	}
+
+	if err == nil {
+		_, _, err = c.cmd(200, "TYPE I")
+	}
+
+	if err != nil {
+		c.close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// dialer returns the Dialer or the zero net.Dialer.
+func (fs *FTPSource) dialer() *net.Dialer {
+	if fs.Dialer != nil {
+		return fs.Dialer
+	}
+
+	return &net.Dialer{}
+}
+
+// ftpPath returns the unescaped file path of the URL relative to the login
+// directory as defined by RFC 1738.
+func ftpPath(u *url.URL) string {
+	return strings.TrimPrefix(u.Path, "/")
+}
+
+// An ftpConn is an FTP control connection.
+type ftpConn struct {
+	conn net.Conn
+	text *textproto.Conn
+}
+
+// cmd sends the command and reads the reply. The reply code must start with
+// the digits of expectCode, any code is accepted if it is zero.
+func (c *ftpConn) cmd(expectCode int, format string, args ...interface{}) (int, string, error) {
+	if _, err := c.text.Cmd(format, args...); err != nil {
+		return 0, "", err
+	}
+
+	return c.text.ReadResponse(expectCode)
+}
+
+// passive enters passive mode with EPSV or PASV and dials the data
+// connection. The host of the control connection is always used because the
+// address in the PASV reply is often wrong behind NAT.
+func (c *ftpConn) passive(ctx context.Context, d *net.Dialer) (net.Conn, error) {
+	host, _, _ := net.SplitHostPort(c.conn.RemoteAddr().String())
+
+	port, err := c.epsv()
+	if err != nil {
+		if port, err = c.pasv(); err != nil {
+			return nil, err
+		}
+	}
+
+	return d.DialContext(ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+}
+
+// epsv parses the "(|||port|)" reply of EPSV.
+func (c *ftpConn) epsv() (int, error) {
+	_, msg, err := c.cmd(229, "EPSV")
+	if err != nil {
+		return 0, err
+	}
+
+	start, end := strings.Index(msg, "(|||"), strings.LastIndex(msg, "|)")
+	if start < 0 || end < start+4 {
+		return 0, fmt.Errorf("invalid EPSV reply %q", msg)
+	}
+
+	return strconv.Atoi(msg[start+4 : end])
+}
+
+// pasv parses the "(h1,h2,h3,h4,p1,p2)" reply of PASV.
+func (c *ftpConn) pasv() (int, error) {
+	_, msg, err := c.cmd(227, "PASV")
+	if err != nil {
+		return 0, err
+	}
+
+	start, end := strings.Index(msg, "("), strings.LastIndex(msg, ")")
+	if start < 0 || end < start {
+		return 0, fmt.Errorf("invalid PASV reply %q", msg)
+	}
+
+	fields := strings.Split(msg[start+1:end], ",")
+	if len(fields) != 6 {
+		return 0, fmt.Errorf("invalid PASV reply %q", msg)
+	}
+
+	hi, err1 := strconv.Atoi(fields[4])
+	lo, err2 := strconv.Atoi(fields[5])
+	if err1 != nil || err2 != nil {
+		return 0, fmt.Errorf("invalid PASV reply %q", msg)
+	}
+
+	return hi<<8 | lo, nil
+}
+
+// port listens on the local address of the control connection and announces
+// it with PORT or EPRT for IPv6.
+func (c *ftpConn) port() (net.Listener, error) {
+	host, _, _ := net.SplitHostPort(c.conn.LocalAddr().String())
+
+	ln, err := net.Listen("tcp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		return nil, err
+	}
+
+	p := ln.Addr().(*net.TCPAddr).Port
+
+	if ip := net.ParseIP(host).To4(); ip != nil {
+		_, _, err = c.cmd(200, "PORT %d,%d,%d,%d,%d,%d", ip[0], ip[1], ip[2], ip[3], p>>8, p&0xff)
+	} else {
+		_, _, err = c.cmd(200, "EPRT |2|%s|%d|", host, p)
+	}
+
+	if err != nil {
+		_ = ln.Close()
+		return nil, err
+	}
+
+	return ln, nil
+}
+
+// close closes the control connection without waiting for the server.
+func (c *ftpConn) close() {
+	_ = c.text.Close()
+}
+
+// An ftpReader reads a range of the transfer. Closing it aborts the transfer
+// by closing the data and control connections, as does canceling the context.
+type ftpReader struct {
+	io.Reader
+	data net.Conn
+	ctrl *ftpConn
+
+	once sync.Once
+	done chan struct{}
+}
+
+// watch closes the reader once the context is canceled.
+func (r *ftpReader) watch(ctx context.Context) {
+	select {
+	case <-ctx.Done():
+		_ = r.Close()
+	case <-r.done:
+	}
+}
+
+func (r *ftpReader) Close() error {
+	r.once.Do(func() {
+		close(r.done)
+		_ = r.data.Close()
+		r.ctrl.close()
+	})
+
+	return nil
+}
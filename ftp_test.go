@@ -0,0 +1,308 @@
+package splitter
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ftpStandIn is an in-process FTP server serving a single file.
+type ftpStandIn struct {
+	ln      net.Listener
+	file    string
+	content string
+	noEPSV  bool
+
+	// noConnect makes the server never open active data connections.
+	noConnect bool
+
+	mu       sync.Mutex
+	commands []string
+}
+
+func newFTPStandIn(t *testing.T, file, content string) *ftpStandIn {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fs := &ftpStandIn{ln: ln, file: file, content: content}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			go fs.serve(conn)
+		}
+	}()
+
+	return fs
+}
+
+func (fs *ftpStandIn) url(userinfo string) string {
+	return fmt.Sprintf("ftp://%s%s/%s", userinfo, fs.ln.Addr(), fs.file)
+}
+
+func (fs *ftpStandIn) close() {
+	_ = fs.ln.Close()
+}
+
+func (fs *ftpStandIn) received(cmd string) []string {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	var args []string
+	for _, c := range fs.commands {
+		if c == cmd || strings.HasPrefix(c, cmd+" ") {
+			args = append(args, strings.TrimPrefix(c, cmd+" "))
+		}
+	}
+
+	return args
+}
+
+func (fs *ftpStandIn) serve(conn net.Conn) {
+	tp := textproto.NewConn(conn)
+	defer tp.Close()
+
+	var (
+		pasv   net.Listener
+		active string
+		offset int
+	)
+
+	_ = tp.PrintfLine("220 ready")
+
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+
+		fs.mu.Lock()
+		fs.commands = append(fs.commands, line)
+		fs.mu.Unlock()
+
+		cmd, arg := line, ""
+		if i := strings.IndexByte(line, ' '); i >= 0 {
+			cmd, arg = line[:i], line[i+1:]
+		}
+
+		switch cmd {
+		case "USER":
+			_ = tp.PrintfLine("331 password required")
+		case "PASS":
+			if arg != "secret" {
+				_ = tp.PrintfLine("530 login incorrect")
+				continue
+			}
+			_ = tp.PrintfLine("230 logged in")
+		case "TYPE":
+			_ = tp.PrintfLine("200 type set")
+		case "SIZE", "MDTM":
+			if arg != fs.file {
+				_ = tp.PrintfLine("550 not found")
+				continue
+			}
+
+			if cmd == "SIZE" {
+				_ = tp.PrintfLine("213 %d", len(fs.content))
+			} else {
+				_ = tp.PrintfLine("213 20200101120000")
+			}
+		case "EPSV", "PASV":
+			if cmd == "EPSV" && fs.noEPSV {
+				_ = tp.PrintfLine("502 not implemented")
+				continue
+			}
+
+			pasv, _ = net.Listen("tcp", "127.0.0.1:0")
+			port := pasv.Addr().(*net.TCPAddr).Port
+
+			if cmd == "EPSV" {
+				_ = tp.PrintfLine("229 Entering Extended Passive Mode (|||%d|)", port)
+			} else {
+				_ = tp.PrintfLine("227 Entering Passive Mode (127,0,0,1,%d,%d)", port>>8, port&0xff)
+			}
+		case "PORT":
+			f := strings.Split(arg, ",")
+			hi, _ := strconv.Atoi(f[4])
+			lo, _ := strconv.Atoi(f[5])
+			active = net.JoinHostPort(strings.Join(f[:4], "."), strconv.Itoa(hi<<8|lo))
+			_ = tp.PrintfLine("200 port set")
+		case "REST":
+			offset, _ = strconv.Atoi(arg)
+			_ = tp.PrintfLine("350 restarting")
+		case "RETR":
+			if pasv == nil && fs.noConnect {
+				_ = tp.PrintfLine("150 opening data connection")
+				continue
+			}
+
+			var data net.Conn
+			if pasv != nil {
+				data, err = pasv.Accept()
+				_ = pasv.Close()
+			} else {
+				data, err = net.Dial("tcp", active)
+			}
+			if err != nil {
+				_ = tp.PrintfLine("425 cannot open data connection")
+				continue
+			}
+
+			_ = tp.PrintfLine("150 opening data connection")
+			_, _ = data.Write([]byte(fs.content[offset:]))
+			_ = data.Close()
+			_ = tp.PrintfLine("226 transfer complete")
+			pasv, offset = nil, 0
+		case "QUIT":
+			_ = tp.PrintfLine("221 bye")
+			return
+		default:
+			_ = tp.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+func TestFTPSourcePassive(t *testing.T) {
+	dir, f := initTmpStorage()
+	defer os.RemoveAll(dir)
+
+	fs := newFTPStandIn(t, "file.txt", "abcdefghijkl")
+	defer fs.close()
+
+	pi, err := NewPathResolver(fs.url("user:secret@"), dir, nil).PathInfo()
+	assert.NoError(t, err)
+	assert.Equal(t, 12, pi.Source.Size)
+	assert.Equal(t, ".txt", pi.Source.Ext)
+	assert.Equal(t, "20200101120000", pi.Source.LastModified)
+	assert.Equal(t, path.Join(dir, "file.txt"), pi.Dest.Name())
+
+	s := NewSplitter(context.Background(), pi, 3, nil)
+	assert.NoError(t, s.Download())
+	assert.ElementsMatch(t, []string{"4", "8"}, fs.received("REST"))
+	assert.Equal(t, []string{"user", "user", "user", "user"}, fs.received("USER"))
+
+	content, _ := ioutil.ReadFile(pi.Dest.Name())
+	assert.Equal(t, "abcdefghijkl", string(content))
+	_ = f.Close()
+}
+
+func TestFTPSourceActive(t *testing.T) {
+	dir, f := initTmpStorage()
+	defer os.RemoveAll(dir)
+
+	fs := newFTPStandIn(t, "file.txt", "abcdefghijkl")
+	fs.noEPSV = true
+	defer fs.close()
+
+	pr := NewPathResolver(fs.url("user:secret@"), f.Name(), nil)
+	pr.FTP = &FTPSource{Active: true}
+
+	pi, err := pr.PathInfo()
+	assert.NoError(t, err)
+
+	s := NewSplitter(context.Background(), pi, 2, nil)
+	assert.NoError(t, s.Download())
+	assert.Len(t, fs.received("PORT"), 2)
+
+	content, _ := ioutil.ReadFile(f.Name())
+	assert.Equal(t, "abcdefghijkl", string(content))
+}
+
+func TestFTPSourcePassiveFallback(t *testing.T) {
+	fs := newFTPStandIn(t, "file.txt", "abcdef")
+	fs.noEPSV = true
+	defer fs.close()
+
+	src := &Source{Backend: &FTPSource{}}
+	src.Path, _ = url.Parse(fs.url("user:secret@"))
+
+	body, err := src.Backend.OpenRange(context.Background(), src, DownloadRange{Start: 2, End: 4})
+	assert.NoError(t, err)
+
+	data, _ := ioutil.ReadAll(body)
+	assert.NoError(t, body.Close())
+	assert.Equal(t, "cd", string(data))
+	assert.Len(t, fs.received("PASV"), 1)
+}
+
+func TestFTPSourceNetrc(t *testing.T) {
+	fs := newFTPStandIn(t, "file.txt", "abcdef")
+	defer fs.close()
+
+	n, _ := ParseNetrc(strings.NewReader("machine 127.0.0.1 login netrc password secret"))
+
+	uri, _ := url.Parse(fs.url(""))
+
+	src, err := NewBackendSource(uri, &FTPSource{Netrc: n})
+	assert.NoError(t, err)
+	assert.Equal(t, 6, src.Size)
+	assert.Equal(t, []string{"netrc"}, fs.received("USER"))
+}
+
+func TestFTPSourceLoginError(t *testing.T) {
+	fs := newFTPStandIn(t, "file.txt", "abcdef")
+	defer fs.close()
+
+	_, err := NewPathResolver(fs.url("user:wrong@"), os.TempDir(), nil).PathInfo()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot fetch source info: 530")
+}
+
+func TestFTPSourceLineBreak(t *testing.T) {
+	fs := newFTPStandIn(t, "file.txt", "abcdef")
+	defer fs.close()
+
+	for _, raw := range []string{
+		fs.url("user:secret@") + "%0D%0ADELE%20file.txt",
+		fs.url("user%0D%0ADELE%20file.txt:secret@"),
+		fs.url("user:secret%0A@"),
+	} {
+		_, err := NewPathResolver(raw, os.TempDir(), nil).PathInfo()
+		assert.EqualError(t, err, "splitter: source: cannot fetch source info: line break in URL path or credentials", raw)
+	}
+
+	assert.Empty(t, fs.received("USER"))
+}
+
+func TestFTPSourceActiveCancel(t *testing.T) {
+	fs := newFTPStandIn(t, "file.txt", "abcdef")
+	fs.noEPSV = true
+	fs.noConnect = true
+	defer fs.close()
+
+	src := &Source{Backend: &FTPSource{Active: true}}
+	src.Path, _ = url.Parse(fs.url("user:secret@"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := src.Backend.OpenRange(ctx, src, DownloadRange{Start: 0, End: 6})
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		assert.EqualError(t, err, "splitter: cannot open data connection: context canceled")
+	case <-time.After(5 * time.Second):
+		t.Fatal("OpenRange did not return after cancel")
+	}
+}
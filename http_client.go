@@ -10,3 +10,26 @@ type HTTPClient interface {
 	Do(req *http.Request) (*http.Response, error)
 	Get(url string) (resp *http.Response, err error)
 }
+
+// A requestClient applies the RequestOptions to every request of the client.
+// Headers already set on the request, e.g. by an outer requestClient, are
+// kept.
+type requestClient struct {
+	client  HTTPClient
+	options *RequestOptions
+}
+
+func (rc *requestClient) Do(req *http.Request) (*http.Response, error) {
+	rc.options.apply(req)
+
+	return rc.client.Do(req)
+}
+
+func (rc *requestClient) Get(url string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return rc.Do(req)
+}
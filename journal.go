@@ -0,0 +1,335 @@
+package splitter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// JournalSuffix is appended to the destination file name to build the path of
+// the resume journal that lives next to the destination during a download.
+const JournalSuffix = ".splitter"
+
+// journalFlushInterval limits how often the journal is written to disk while
+// chunks are in progress. Completed chunks are always flushed immediately.
+const journalFlushInterval = time.Second
+
+// JournalError represent error message and context for resume journal.
+type JournalError struct {
+	context string
+	err     error
+}
+
+func (je *JournalError) Error() string {
+	return fmt.Sprintf("splitter: journal: %s: %v", je.context, je.err)
+}
+
+// chunk is a DownloadRange together with the number of bytes of it that are
+// confirmed to be written to the destination. Once a download is running the
+// fields are guarded by the journal mutex because an idle worker may shorten
+// the End of a chunk that is still in progress.
+type chunk struct {
+	Start   int `json:"start"`
+	End     int `json:"end"`
+	Written int `json:"written"`
+
+	state   ChunkState
+	retries int
+}
+
+// remaining returns the part of the chunk that still has to be downloaded.
+func (c *chunk) remaining() DownloadRange {
+	return DownloadRange{Start: c.Start + c.Written, End: c.End}
+}
+
+// left returns the number of bytes of the chunk that were not written yet.
+func (c *chunk) left() int {
+	return c.End - c.Start - c.Written
+}
+
+// done reports whether all bytes of the chunk were written.
+func (c *chunk) done() bool {
+	return c.left() <= 0
+}
+
+// A journal is a durable record of the download state. It is stored as JSON
+// next to the destination file and allows Resume to fetch only the parts of
+// the source that never reached the destination.
+//
+// Progress is recorded only after the bytes were handed to the destination and
+// the destination is synced before every flush, so the journal may lag behind
+// the file but never claims bytes that are not there.
+type journal struct {
+	Source       string   `json:"source"`
+	Size         int      `json:"size"`
+	ETag         string   `json:"etag,omitempty"`
+	LastModified string   `json:"last_modified,omitempty"`
+	Chunks       []*chunk `json:"chunks"`
+
+	path    string
+	dest    *os.File
+	mu      sync.Mutex
+	flushed time.Time
+
+	// flushMu serializes flushes, so an older snapshot never replaces a newer
+	// one. j.mu is not held while the destination is synced.
+	flushMu sync.Mutex
+}
+
+// journalPath returns the journal path for the destination file.
+func journalPath(dest *os.File) string {
+	return dest.Name() + JournalSuffix
+}
+
+// newJournal creates a journal for the source split by the RangeBuilder. The
+// journal is kept in memory only if dest is nil.
+func newJournal(s *Source, dest *os.File, rb *RangeBuilder) *journal {
+	j := &journal{
+		Source:       redactURL(s.Path),
+		Size:         s.Size,
+		ETag:         s.ETag,
+		LastModified: s.LastModified,
+		dest:         dest,
+	}
+
+	if dest != nil {
+		j.path = journalPath(dest)
+	}
+
+	for {
+		r, err := rb.NextRange()
+		if err == ErrOutOfRange {
+			break
+		}
+
+		j.Chunks = append(j.Chunks, &chunk{Start: r.Start, End: r.End})
+	}
+
+	return j
+}
+
+// loadJournal reads the journal of the destination file. The returned error
+// satisfies os.IsNotExist if no journal was stored.
+func loadJournal(dest *os.File) (*journal, error) {
+	p := journalPath(dest)
+
+	data, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+
+	j := &journal{path: p, dest: dest}
+	if err := json.Unmarshal(data, j); err != nil {
+		return nil, &JournalError{context: "cannot decode " + p, err: err}
+	}
+
+	for _, c := range j.Chunks {
+		if c.done() {
+			c.state = ChunkDone
+		}
+	}
+
+	return j, nil
+}
+
+// matches checks that the journal was created for the same source. Journals
+// written before credentials were redacted store the full URL.
+func (j *journal) matches(s *Source) bool {
+	return j.Source == redactURL(s.Path) || j.Source == s.Path.String()
+}
+
+// changed reports whether the source was modified since the journal was
+// created.
+func (j *journal) changed(s *Source) bool {
+	return j.Size != s.Size ||
+		validatorChanged(j.ETag, s.ETag) ||
+		validatorChanged(j.LastModified, s.LastModified)
+}
+
+// advance records n more bytes written for the chunk and flushes the journal
+// if the chunk is complete or the flush interval elapsed.
+func (j *journal) advance(c *chunk, n int) error {
+	if j == nil {
+		c.Written += n
+		return nil
+	}
+
+	j.mu.Lock()
+	c.Written += n
+
+	due := c.done() || time.Since(j.flushed) >= journalFlushInterval
+	if due {
+		// The other workers wait for the next interval instead of flushing
+		// as well.
+		j.flushed = time.Now()
+	}
+	j.mu.Unlock()
+
+	if !due {
+		return nil
+	}
+
+	return j.flush()
+}
+
+// save unconditionally flushes the journal.
+func (j *journal) save() error {
+	if j == nil {
+		return nil
+	}
+
+	return j.flush()
+}
+
+// flush syncs the destination and atomically replaces the journal file. The
+// chunks are encoded under j.mu before the sync, so the bytes they claim are
+// on disk once the journal is, while the workers are not blocked by the sync.
+func (j *journal) flush() error {
+	if j.path == "" {
+		return nil
+	}
+
+	j.flushMu.Lock()
+	defer j.flushMu.Unlock()
+
+	j.mu.Lock()
+	data, err := json.Marshal(j)
+	j.mu.Unlock()
+
+	if err != nil {
+		return &JournalError{context: "cannot encode", err: err}
+	}
+
+	if err := j.dest.Sync(); err != nil {
+		return &JournalError{context: "cannot sync destination", err: err}
+	}
+
+	tmp := j.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0666); err != nil {
+		return &JournalError{context: "cannot write " + tmp, err: err}
+	}
+
+	if err := os.Rename(tmp, j.path); err != nil {
+		return &JournalError{context: "cannot replace " + j.path, err: err}
+	}
+
+	return nil
+}
+
+// remove deletes the journal once the download is complete.
+func (j *journal) remove() error {
+	if j == nil || j.path == "" {
+		return nil
+	}
+
+	err := os.Remove(j.path)
+	if err != nil && !os.IsNotExist(err) {
+		return &JournalError{context: "cannot remove " + j.path, err: err}
+	}
+
+	return nil
+}
+
+// remaining returns the part of the chunk that still has to be downloaded.
+func (j *journal) remaining(c *chunk) DownloadRange {
+	if j == nil {
+		return c.remaining()
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return c.remaining()
+}
+
+// reset discards the progress of the chunk.
+func (j *journal) reset(c *chunk) {
+	if j == nil {
+		c.Written = 0
+		return
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	c.Written = 0
+}
+
+// split moves the second half of the bytes remaining in the largest of the
+// chunks to a new chunk that is added to the journal. No chunk is split if
+// each of them has less than minSize bytes left or minSize is negative.
+func (j *journal) split(chunks []*chunk, minSize int) *chunk {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if minSize < 0 {
+		return nil
+	}
+
+	var largest *chunk
+	for _, c := range chunks {
+		if largest == nil || c.left() > largest.left() {
+			largest = c
+		}
+	}
+
+	if largest == nil || largest.left() < 2*minSize || largest.left() < 2 {
+		return nil
+	}
+
+	r := largest.remaining()
+	mid := r.Start + (r.End-r.Start)/2
+	stolen := &chunk{Start: mid, End: largest.End}
+	largest.End = mid
+	j.Chunks = append(j.Chunks, stolen)
+
+	return stolen
+}
+
+// setState moves the chunk to the state. Every transition to ChunkRetrying is
+// counted as a retry.
+func (j *journal) setState(c *chunk, state ChunkState) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	c.state = state
+	if state == ChunkRetrying {
+		c.retries++
+	}
+}
+
+// progress returns a snapshot of all chunks. Speed and ETA are left empty.
+func (j *journal) progress() Progress {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	p := Progress{Total: j.Size, Chunks: make([]ChunkProgress, 0, len(j.Chunks))}
+
+	for _, c := range j.Chunks {
+		p.Downloaded += c.Written
+		p.Chunks = append(p.Chunks, ChunkProgress{
+			Range:   DownloadRange{Start: c.Start, End: c.End},
+			Written: c.Written,
+			State:   c.state,
+			Retries: c.retries,
+		})
+	}
+
+	return p
+}
+
+// pending returns chunks that still have bytes to download.
+func (j *journal) pending() []*chunk {
+	var p []*chunk
+
+	for _, c := range j.Chunks {
+		if !c.done() {
+			p = append(p, c)
+		}
+	}
+
+	return p
+}
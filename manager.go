@@ -0,0 +1,395 @@
+package splitter
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+)
+
+// DefaultMaxJobs is the number of jobs downloaded at once when
+// Manager.MaxJobs is not set.
+const DefaultMaxJobs = 4
+
+// ErrJobNotFound is returned by Manager methods called with a job that was
+// not added to the manager.
+var ErrJobNotFound = errors.New("splitter: job not found")
+
+// JobState describes the life cycle of a Job.
+type JobState int
+
+// Job states reported by Manager.State and Manager.Status.
+const (
+	JobQueued JobState = iota
+	JobActive
+	JobPaused
+	JobFailed
+	JobComplete
+)
+
+var jobStateNames = [...]string{
+	JobQueued:   "queued",
+	JobActive:   "active",
+	JobPaused:   "paused",
+	JobFailed:   "failed",
+	JobComplete: "complete",
+}
+
+func (js JobState) String() string {
+	if js < 0 || int(js) >= len(jobStateNames) {
+		return "unknown"
+	}
+
+	return jobStateNames[js]
+}
+
+// A Job is a single download of a Manager. The source and destination are
+// resolved with PathResolver when the job becomes active.
+type Job struct {
+	Source string
+	Dest   string
+
+	// DestFile makes Dest the path of the output file, see
+	// PathResolver.DestFile.
+	DestFile bool
+
+	// Priority orders the queued jobs and the connections of active jobs.
+	// Jobs with higher priority go first, jobs with equal priority in the
+	// order they were added. It must not be changed after the job is added,
+	// use Manager.SetPriority instead.
+	Priority int
+
+	// Configure is called with the Splitter of the job before the download
+	// starts, e.g. to set Checksum or Retry.
+	Configure func(*Splitter)
+
+	// Request customizes the requests of the job, see PathResolver.Request.
+	Request *RequestOptions
+
+	seq      int
+	state    JobState
+	err      error
+	progress Progress
+	splitter *Splitter
+	cancel   context.CancelFunc
+
+	// running is set until the download of a paused job returns.
+	running bool
+}
+
+// A JobStatus is a snapshot of a Job.
+type JobStatus struct {
+	Job      *Job
+	State    JobState
+	Err      error
+	Progress Progress
+}
+
+// A Manager downloads many jobs in one process. At most MaxJobs jobs are
+// active at once, and the connections of all jobs are capped by a shared
+// ConnLimiter.
+type Manager struct {
+	// MaxJobs limits the number of active jobs. DefaultMaxJobs is used if it
+	// is zero.
+	MaxJobs int
+
+	// ChunkCnt is the number of chunks of every job.
+	ChunkCnt int
+
+	ctx    context.Context
+	client HTTPClient
+	conns  *ConnLimiter
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	jobs   []*Job
+	seq    int
+	active int
+}
+
+// NewManager creates new Manager instance. The connections of all jobs are
+// limited to maxConns in total and maxConnsPerHost per host, zero means no
+// limit.
+func NewManager(ctx context.Context, c HTTPClient, chunkCnt, maxConns, maxConnsPerHost int) *Manager {
+	m := &Manager{
+		ChunkCnt: chunkCnt,
+		ctx:      ctx,
+		client:   c,
+		conns:    NewConnLimiter(maxConns, maxConnsPerHost),
+	}
+	m.cond = sync.NewCond(&m.mu)
+
+	return m
+}
+
+// Add queues the job.
+func (m *Manager) Add(j *Job) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.seq++
+	j.seq = m.seq
+	j.state = JobQueued
+	m.jobs = append(m.jobs, j)
+
+	m.dispatch()
+}
+
+// SetPriority changes the priority of the job. It reorders the queue and
+// affects the connections of an active job.
+func (m *Manager) SetPriority(j *Job, priority int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.has(j) {
+		return ErrJobNotFound
+	}
+
+	j.Priority = priority
+	if j.splitter != nil {
+		j.splitter.SetPriority(priority)
+	}
+
+	return nil
+}
+
+// Pause stops a queued or active job. The written part of an active job is
+// kept and continued by Resume.
+func (m *Manager) Pause(j *Job) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.has(j) {
+		return ErrJobNotFound
+	}
+
+	switch j.state {
+	case JobQueued:
+		j.state = JobPaused
+	case JobActive:
+		j.state = JobPaused
+		j.cancel()
+	}
+
+	return nil
+}
+
+// Resume queues a paused or failed job again. A job that was started
+// continues from the written part.
+func (m *Manager) Resume(j *Job) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.has(j) {
+		return ErrJobNotFound
+	}
+
+	if j.state == JobPaused || j.state == JobFailed {
+		j.state = JobQueued
+		j.err = nil
+		m.dispatch()
+	}
+
+	return nil
+}
+
+// State returns the state of the job.
+func (m *Manager) State(j *Job) JobState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return j.state
+}
+
+// Err returns the error of a failed job.
+func (m *Manager) Err(j *Job) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return j.err
+}
+
+// Status returns a snapshot of all jobs in the order they were added.
+func (m *Manager) Status() []JobStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	status := make([]JobStatus, len(m.jobs))
+	for i, j := range m.jobs {
+		status[i] = JobStatus{
+			Job:      j,
+			State:    j.state,
+			Err:      j.err,
+			Progress: j.progress,
+		}
+	}
+
+	return status
+}
+
+// Wait blocks until no job is queued or active and the downloads of paused
+// jobs returned. It returns the error of the first failed job.
+func (m *Manager) Wait() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for m.pending() {
+		m.cond.Wait()
+	}
+
+	for _, j := range m.jobs {
+		if j.state == JobFailed {
+			return j.err
+		}
+	}
+
+	return nil
+}
+
+// pending reports whether any job is queued or running. m.mu must be held.
+func (m *Manager) pending() bool {
+	for _, j := range m.jobs {
+		if j.state == JobQueued || j.running {
+			return true
+		}
+	}
+
+	return false
+}
+
+// has reports whether the job was added. m.mu must be held.
+func (m *Manager) has(j *Job) bool {
+	for _, mj := range m.jobs {
+		if mj == j {
+			return true
+		}
+	}
+
+	return false
+}
+
+// maxJobs returns the limit of active jobs.
+func (m *Manager) maxJobs() int {
+	if m.MaxJobs > 0 {
+		return m.MaxJobs
+	}
+
+	return DefaultMaxJobs
+}
+
+// dispatch starts the queued jobs with the highest priority while the limit
+// of active jobs allows. m.mu must be held.
+func (m *Manager) dispatch() {
+	for m.active < m.maxJobs() {
+		var next *Job
+
+		for _, j := range m.jobs {
+			if j.state != JobQueued || j.running {
+				continue
+			}
+
+			if next == nil || j.Priority > next.Priority ||
+				j.Priority == next.Priority && j.seq < next.seq {
+				next = j
+			}
+		}
+
+		if next == nil {
+			return
+		}
+
+		ctx, cancel := context.WithCancel(m.ctx)
+		next.state = JobActive
+		next.running = true
+		next.cancel = cancel
+		m.active++
+
+		go m.run(ctx, next)
+	}
+}
+
+// run downloads the job and records the result. The destination is closed
+// until the job is resumed.
+func (m *Manager) run(ctx context.Context, j *Job) {
+	err := m.download(ctx, j)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	j.cancel()
+	j.running = false
+	m.active--
+
+	switch {
+	case j.state == JobPaused:
+	case j.state == JobQueued && err != nil:
+		// Resumed before the paused download returned, dispatch restarts it.
+	case err != nil:
+		j.state = JobFailed
+		j.err = err
+	default:
+		j.state = JobComplete
+	}
+
+	if j.splitter != nil {
+		_ = j.splitter.PI.Dest.Close()
+	}
+
+	m.dispatch()
+	m.cond.Broadcast()
+}
+
+// download resolves the paths and downloads the job, or resumes it if it was
+// started before.
+func (m *Manager) download(ctx context.Context, j *Job) error {
+	m.mu.Lock()
+	s := j.splitter
+	m.mu.Unlock()
+
+	if s != nil {
+		// A failed Atomic download removes the destination it created.
+		f, err := os.OpenFile(s.PI.Dest.Name(), os.O_RDWR|os.O_CREATE, 0666)
+		if err != nil {
+			return &splitterError{context: "cannot reopen destination", err: err}
+		}
+
+		s.Ctx = ctx
+		s.PI.Dest = f
+
+		return s.Resume()
+	}
+
+	pr := NewPathResolver(j.Source, j.Dest, m.client)
+	pr.DestFile = j.DestFile
+	pr.Request = j.Request
+
+	pi, err := pr.PathInfo()
+	if err != nil {
+		return err
+	}
+
+	s = NewSplitter(ctx, pi, m.ChunkCnt, m.client)
+	s.ConnLimit = m.conns
+
+	if j.Configure != nil {
+		j.Configure(s)
+	}
+
+	onProgress := s.OnProgress
+	s.OnProgress = func(p Progress) {
+		m.mu.Lock()
+		j.progress = p
+		m.mu.Unlock()
+
+		if onProgress != nil {
+			onProgress(p)
+		}
+	}
+
+	m.mu.Lock()
+	s.SetPriority(j.Priority)
+	j.splitter = s
+	m.mu.Unlock()
+
+	return s.Download()
+}
@@ -0,0 +1,199 @@
+package splitter
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestManagerDownloadsJobs(t *testing.T) {
+	dir, _ := initTmpStorage()
+	defer os.RemoveAll(dir)
+
+	m := NewManager(context.Background(), nil, 2, 3, 0)
+	m.MaxJobs = 2
+
+	var jobs []*Job
+	for i := 0; i < 5; i++ {
+		src := filepath.Join(dir, fmt.Sprintf("source%d.bin", i))
+		_ = ioutil.WriteFile(src, []byte(strings.Repeat(fmt.Sprint(i), 100)), 0666)
+
+		j := &Job{Source: src, Dest: filepath.Join(dir, fmt.Sprintf("dest%d.bin", i))}
+		_ = ioutil.WriteFile(j.Dest, nil, 0666)
+
+		jobs = append(jobs, j)
+		m.Add(j)
+	}
+
+	assert.NoError(t, m.Wait())
+
+	for i, st := range m.Status() {
+		assert.Equal(t, jobs[i], st.Job)
+		assert.Equal(t, JobComplete, st.State)
+		assert.Equal(t, 100, st.Progress.Downloaded)
+
+		content, _ := ioutil.ReadFile(jobs[i].Dest)
+		assert.Equal(t, strings.Repeat(fmt.Sprint(i), 100), string(content))
+	}
+}
+
+func TestManagerPriority(t *testing.T) {
+	dir, _ := initTmpStorage()
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "source.bin")
+	_ = ioutil.WriteFile(src, []byte("abcdef"), 0666)
+
+	m := NewManager(context.Background(), nil, 1, 0, 0)
+	m.MaxJobs = 1
+
+	var mu sync.Mutex
+	var started []string
+	release := make(chan struct{})
+
+	newJob := func(name string, priority int) *Job {
+		_ = ioutil.WriteFile(filepath.Join(dir, name+".bin"), nil, 0666)
+
+		return &Job{
+			Source:   src,
+			Dest:     filepath.Join(dir, name+".bin"),
+			Priority: priority,
+			Configure: func(s *Splitter) {
+				mu.Lock()
+				started = append(started, name)
+				mu.Unlock()
+
+				if name == "first" {
+					<-release
+				}
+			},
+		}
+	}
+
+	m.Add(newJob("first", 0))
+	low, high, bumped := newJob("low", 1), newJob("high", 5), newJob("bumped", 0)
+	m.Add(low)
+	m.Add(high)
+	m.Add(bumped)
+	assert.NoError(t, m.SetPriority(bumped, 3))
+	assert.Equal(t, JobQueued, m.State(low))
+
+	close(release)
+	assert.NoError(t, m.Wait())
+	assert.Equal(t, []string{"first", "high", "bumped", "low"}, started)
+}
+
+func TestManagerPauseResume(t *testing.T) {
+	dir, f := initTmpStorage()
+	defer os.RemoveAll(dir)
+
+	GetHeadFunc = func(url string) (*http.Response, error) {
+		return &http.Response{
+			StatusCode:    200,
+			Header:        http.Header{"Content-Type": {"text/plain"}},
+			ContentLength: 6,
+		}, nil
+	}
+
+	respond := rangeResponder("abcdef")
+	requested := make(chan struct{})
+	block := true
+
+	GetDoFunc = func(req *http.Request) (*http.Response, error) {
+		if block {
+			block = false
+			close(requested)
+			<-req.Context().Done()
+
+			return nil, req.Context().Err()
+		}
+
+		return respond(req)
+	}
+
+	m := NewManager(context.Background(), &mockClient{}, 1, 0, 0)
+	j := &Job{Source: "http://source.com/file.txt", Dest: f.Name()}
+	m.Add(j)
+
+	<-requested
+	assert.NoError(t, m.Pause(j))
+	assert.NoError(t, m.Wait())
+	assert.Equal(t, JobPaused, m.State(j))
+
+	assert.NoError(t, m.Resume(j))
+	assert.NoError(t, m.Wait())
+	assert.Equal(t, JobComplete, m.State(j))
+
+	content, _ := ioutil.ReadFile(f.Name())
+	assert.Equal(t, "abcdef", string(content))
+}
+
+func TestManagerPauseResumeRunning(t *testing.T) {
+	dir, f := initTmpStorage()
+	defer os.RemoveAll(dir)
+
+	GetHeadFunc = func(url string) (*http.Response, error) {
+		return &http.Response{
+			StatusCode:    200,
+			Header:        http.Header{"Content-Type": {"text/plain"}},
+			ContentLength: 6,
+		}, nil
+	}
+
+	respond := rangeResponder("abcdef")
+	requested := make(chan struct{})
+	release := make(chan struct{})
+	block := true
+
+	GetDoFunc = func(req *http.Request) (*http.Response, error) {
+		if block {
+			block = false
+			close(requested)
+			<-req.Context().Done()
+			<-release
+
+			return nil, req.Context().Err()
+		}
+
+		return respond(req)
+	}
+
+	m := NewManager(context.Background(), &mockClient{}, 1, 0, 0)
+	j := &Job{Source: "http://source.com/file.txt", Dest: f.Name()}
+	m.Add(j)
+
+	<-requested
+	assert.NoError(t, m.Pause(j))
+	assert.NoError(t, m.Resume(j))
+	assert.Equal(t, JobQueued, m.State(j))
+
+	// The paused download returns only after the job was resumed.
+	close(release)
+
+	assert.NoError(t, m.Wait())
+	assert.Equal(t, JobComplete, m.State(j))
+
+	content, _ := ioutil.ReadFile(f.Name())
+	assert.Equal(t, "abcdef", string(content))
+}
+
+func TestManagerFailedJob(t *testing.T) {
+	dir, _ := initTmpStorage()
+	defer os.RemoveAll(dir)
+
+	m := NewManager(context.Background(), nil, 1, 0, 0)
+	j := &Job{Source: filepath.Join(dir, "missing.bin"), Dest: dir}
+	m.Add(j)
+
+	assert.Error(t, m.Wait())
+	assert.Equal(t, JobFailed, m.State(j))
+	assert.Equal(t, ErrJobNotFound, m.Pause(&Job{}))
+	assert.Equal(t, "failed", m.State(j).String())
+}
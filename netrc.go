@@ -0,0 +1,194 @@
+package splitter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// A Netrc holds the credentials of a .netrc file. It provides the Basic
+// authentication of HTTP sources through RequestOptions.Netrc and the login of
+// FTP sources through FTPSource.Netrc.
+type Netrc struct {
+	machines []netrcMachine
+}
+
+// netrcMachine is a machine entry of a .netrc file. The default entry has an
+// empty name.
+type netrcMachine struct {
+	name     string
+	login    string
+	password string
+}
+
+// ParseNetrc parses a .netrc file. Macro definitions are skipped and lines
+// starting with "#" are comments.
+func ParseNetrc(r io.Reader) (*Netrc, error) {
+	n := &Netrc{}
+
+	var (
+		m      *netrcMachine
+		macdef bool
+	)
+
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+
+		// A macro definition ends with an empty line.
+		if macdef {
+			macdef = text != ""
+			continue
+		}
+
+		if strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		tokens := strings.Fields(text)
+		for i := 0; i < len(tokens); i++ {
+			token := tokens[i]
+
+			if token == "default" {
+				n.machines = append(n.machines, netrcMachine{})
+				m = &n.machines[len(n.machines)-1]
+
+				continue
+			}
+
+			if i+1 == len(tokens) {
+				return nil, &splitterError{
+					context: fmt.Sprintf("netrc line %d", line),
+					err:     fmt.Errorf("missing value of %q", token),
+				}
+			}
+
+			i++
+			value := tokens[i]
+
+			switch token {
+			case "machine":
+				n.machines = append(n.machines, netrcMachine{name: value})
+				m = &n.machines[len(n.machines)-1]
+
+				continue
+			case "macdef":
+				macdef = true
+				i = len(tokens)
+
+				continue
+			}
+
+			if m == nil {
+				return nil, &splitterError{
+					context: fmt.Sprintf("netrc line %d", line),
+					err:     fmt.Errorf("%q outside of machine", token),
+				}
+			}
+
+			switch token {
+			case "login":
+				m.login = value
+			case "password":
+				m.password = value
+			}
+		}
+	}
+
+	if err := sc.Err(); err != nil {
+		return nil, &splitterError{context: "cannot read netrc", err: err}
+	}
+
+	return n, nil
+}
+
+// LoadNetrc reads the .netrc file at the path.
+func LoadNetrc(path string) (*Netrc, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, &splitterError{context: "cannot read netrc", err: err}
+	}
+	defer f.Close()
+
+	return ParseNetrc(f)
+}
+
+// DefaultNetrc reads the file named by the NETRC environment variable or
+// .netrc in the home directory, _netrc on Windows. A missing file in the home
+// directory yields a Netrc without credentials.
+func DefaultNetrc() (*Netrc, error) {
+	if p := os.Getenv("NETRC"); p != "" {
+		return LoadNetrc(p)
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return &Netrc{}, nil
+	}
+
+	name := ".netrc"
+	if runtime.GOOS == "windows" {
+		name = "_netrc"
+	}
+
+	p := filepath.Join(home, name)
+	if _, err := os.Stat(p); os.IsNotExist(err) {
+		return &Netrc{}, nil
+	}
+
+	return LoadNetrc(p)
+}
+
+// Credentials returns the login and password of the host. The first machine
+// entry of the host is used, the default entry otherwise.
+func (n *Netrc) Credentials(host string) (string, string, bool) {
+	if n == nil {
+		return "", "", false
+	}
+
+	var def *netrcMachine
+
+	for i, m := range n.machines {
+		switch {
+		case m.name == "" && def == nil:
+			def = &n.machines[i]
+		case m.name != "" && strings.EqualFold(m.name, host):
+			return m.login, m.password, true
+		}
+	}
+
+	if def == nil {
+		return "", "", false
+	}
+
+	return def.login, def.password, true
+}
+
+// redactURL returns the URL without its credentials, so it can be logged and
+// persisted.
+func redactURL(u *url.URL) string {
+	if u.User == nil {
+		return u.String()
+	}
+
+	redacted := *u
+	redacted.User = nil
+
+	return redacted.String()
+}
+
+// redactRawURL returns the raw URL without its credentials. Unparsable URLs are
+// returned as is.
+func redactRawURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+
+	return redactURL(u)
+}
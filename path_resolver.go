@@ -1,11 +1,13 @@
 package splitter
 
 import (
+	"context"
 	"fmt"
 	"net/url"
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
 )
 
 // PathResolverError represent error message and context for path resolver.
@@ -22,6 +24,10 @@ func (pr *PathResolverError) Error() string {
 type PathInfo struct {
 	Source *Source
 	Dest   *os.File
+
+	// created is set if PathResolver created Dest, so a failed Atomic
+	// download can remove it.
+	created bool
 }
 
 // A PathResolver allows to resolve source path and destination path. Provides
@@ -30,6 +36,20 @@ type PathInfo struct {
 type PathResolver struct {
 	Source string
 	Dest   string
+
+	// DestFile makes Dest the path of the destination file, which is created
+	// if it does not exist. Otherwise Dest is a file if it has an extension
+	// and a directory if it has none.
+	DestFile bool
+
+	// FTP fetches ftp:// sources. Passive mode with the zero FTPSource is
+	// used if it is nil.
+	FTP *FTPSource
+
+	// Request customizes the requests to HTTP sources. It is kept in
+	// Source.Request, so the chunk requests of Splitter use it as well.
+	Request *RequestOptions
+
 	client HTTPClient
 }
 
@@ -47,22 +67,32 @@ func (pr *PathResolver) PathInfo() (*PathInfo, error) {
 		return nil, err
 	}
 
-	s, err := NewSource(rawSource, pr.client)
+	s, err := pr.newSource(rawSource)
 	if err != nil {
 		return nil, err
 	}
 
-	d, err := pr.resolveDest(s)
+	d, created, err := pr.resolveDest(s)
 	if err != nil {
 		return nil, err
 	}
 
-	return &PathInfo{Source: s, Dest: d}, nil
+	return &PathInfo{Source: s, Dest: d, created: created}, nil
 }
 
 // resolveSource resolves provided source path and create *url.URL instance
-// or return error in case of invalid path.
+// or return error in case of invalid path. A source without a scheme is a
+// local path and is resolved to an absolute file:// URL.
 func (pr *PathResolver) resolveSource() (*url.URL, error) {
+	if !strings.Contains(pr.Source, "://") {
+		uri, err := fileURL(pr.Source)
+		if err != nil {
+			return nil, &PathResolverError{context: "invalid source path", err: err}
+		}
+
+		return uri, nil
+	}
+
 	uri, err := url.ParseRequestURI(pr.Source)
 	if err != nil {
 		return nil, &PathResolverError{context: "invalid source path", err: err}
@@ -71,42 +101,124 @@ func (pr *PathResolver) resolveSource() (*url.URL, error) {
 	return uri, nil
 }
 
+// newSource creates the Source with the RangeSource of the URL scheme.
+func (pr *PathResolver) newSource(uri *url.URL) (*Source, error) {
+	switch uri.Scheme {
+	case "ftp":
+		fs := pr.FTP
+		if fs == nil {
+			fs = &FTPSource{}
+		}
+
+		return NewBackendSource(uri, fs)
+	case "file":
+		return NewBackendSource(uri, &FileSource{})
+	}
+
+	s := &Source{Path: uri, Request: pr.Request, client: pr.client}
+
+	return s, s.enrichSourceInfo(context.Background())
+}
+
 // resolveDest resolves provided destination path and create *os.File instance
 // or return error in case of invalid path or lack of permissions. It accepts
-// full path with file extension as well as dir path. In last case file name
-// from source will be used.
-func (pr *PathResolver) resolveDest(s *Source) (*os.File, error) {
+// full path with file extension, any file path with DestFile as well as dir
+// path. In last case the file name suggested by the server is used, or the
+// file name from source path if there is none. An existing file is not
+// truncated, so it can be resumed, but an existing file with the name
+// suggested by the server is only reused to resume it. It reports whether the
+// file was created.
+func (pr *PathResolver) resolveDest(s *Source) (*os.File, bool, error) {
+	if pr.DestFile {
+		f, created, err := openDest(pr.Dest, true)
+		if err != nil {
+			return nil, false, &PathResolverError{
+				context: fmt.Sprintf("cannot open file - %s", pr.Dest),
+				err:     err,
+			}
+		}
+
+		return f, created, nil
+	}
+
 	if _, err := os.Stat(pr.Dest); os.IsNotExist(err) {
-		return nil, err
+		return nil, false, err
 	}
 
 	if extProvided(pr.Dest) {
-		f, err := os.OpenFile(pr.Dest, os.O_RDWR, 0666)
+		f, _, err := openDest(pr.Dest, false)
 		if err != nil {
-			return nil, &PathResolverError{
+			return nil, false, &PathResolverError{
 				context: fmt.Sprintf("cannot open file - %s", pr.Dest),
 				err:     err,
 			}
 		}
 
-		return f, nil
+		return f, false, nil
 	}
 
 	basePath := path.Base(s.Path.Path)
+	hasExt := extProvided(pr.Source)
+
+	if s.FileName != "" {
+		basePath = s.FileName
+		hasExt = extProvided(s.FileName)
+	}
 
-	if !extProvided(pr.Source) {
+	if !hasExt {
 		basePath += s.Ext
 	}
 
-	d, err := os.Create(path.Join(pr.Dest, basePath))
+	name := path.Join(pr.Dest, basePath)
+
+	// Like curl -J, a file named by the server never replaces an existing one,
+	// unless it is an interrupted download of it.
+	if s.FileName != "" && !inProgress(name) {
+		if _, err := os.Stat(name); err == nil {
+			return nil, false, &PathResolverError{
+				context: fmt.Sprintf("refusing to overwrite file - %s", name),
+				err:     os.ErrExist,
+			}
+		}
+	}
+
+	d, created, err := openDest(name, true)
 	if err != nil {
-		return nil, &PathResolverError{
+		return nil, false, &PathResolverError{
 			context: "cannot resolve destination source",
 			err:     err,
 		}
 	}
 
-	return d, nil
+	return d, created, nil
+}
+
+// openDest opens the destination file for writing without truncating it. The
+// file is created if it does not exist and create is set, in which case
+// created is true.
+func openDest(name string, create bool) (f *os.File, created bool, err error) {
+	if create {
+		f, err = os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		if !os.IsExist(err) {
+			return f, err == nil, err
+		}
+	}
+
+	f, err = os.OpenFile(name, os.O_RDWR, 0666)
+
+	return f, false, err
+}
+
+// inProgress checks if the file has the journal or the part file of an
+// interrupted download.
+func inProgress(name string) bool {
+	for _, suffix := range []string{JournalSuffix, PartSuffix} {
+		if _, err := os.Stat(name + suffix); err == nil {
+			return true
+		}
+	}
+
+	return false
 }
 
 // extProvided checks if the path contains an extension part.
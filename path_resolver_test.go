@@ -10,6 +10,7 @@ import (
 	"net/url"
 	"os"
 	"path"
+	"path/filepath"
 	"testing"
 )
 
@@ -40,7 +41,10 @@ func TestPathResolver_PathInfoSourceError(t *testing.T) {
 }
 
 func TestPathResolver_PathInfoSourceInfoError(t *testing.T) {
-	GetGetFunc = func(url string) (*http.Response, error) {
+	GetHeadFunc = func(url string) (*http.Response, error) {
+		return nil, errors.New("http error")
+	}
+	GetDoFunc = func(req *http.Request) (*http.Response, error) {
 		return nil, errors.New("http error")
 	}
 
@@ -87,17 +91,29 @@ func TestResolveSource(t *testing.T) {
 
 func TestResolveSourceError(t *testing.T) {
 	pr := PathResolver{
-		Source: "image_source.jpg",
+		Source: "http://[::1/image_source.jpg",
 		Dest:   os.TempDir(),
 		client: nil,
 	}
 
 	_, err := pr.resolveSource()
-	assert.EqualError(
-		t,
-		err,
-		"splitter: path resolver: invalid source path: parse image_source.jpg: invalid URI for request",
-	)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "splitter: path resolver: invalid source path: parse")
+}
+
+func TestResolveSourceLocalPath(t *testing.T) {
+	pr := PathResolver{
+		Source: "image_source.jpg",
+		Dest:   os.TempDir(),
+		client: nil,
+	}
+
+	s, err := pr.resolveSource()
+	assert.NoError(t, err)
+
+	abs, _ := filepath.Abs("image_source.jpg")
+	assert.Equal(t, "file", s.Scheme)
+	assert.Equal(t, abs, filePath(s))
 }
 
 func TestResolveDest(t *testing.T) {
@@ -106,6 +122,7 @@ func TestResolveDest(t *testing.T) {
 
 	testURL, _ := url.ParseRequestURI("http://source.com/file.txt")
 	noExtURL, _ := url.ParseRequestURI("http://source.com/test")
+	scriptURL, _ := url.ParseRequestURI("http://source.com/download.php")
 
 	destTests := []struct {
 		source           Source
@@ -113,25 +130,43 @@ func TestResolveDest(t *testing.T) {
 		valid            bool
 	}{
 		{
-			Source{testURL, 100, ".txt", nil},
+			Source{Path: testURL, Size: 100, Ext: ".txt"},
 			dir,
 			path.Join(dir, "file.txt"),
 			true,
 		},
 		{
-			Source{noExtURL, 100, ".txt", nil},
+			Source{Path: noExtURL, Size: 100, Ext: ".txt"},
 			f.Name(),
 			f.Name(),
 			true,
 		},
 		{
-			Source{noExtURL, 100, ".txt", nil},
+			Source{Path: noExtURL, Size: 100, Ext: ".txt"},
 			dir,
 			path.Join(dir, "test.txt"),
 			true,
 		},
 		{
-			Source{noExtURL, 100, ".txt", nil},
+			Source{Path: scriptURL, Size: 100, Ext: ".bin", FileName: "report.pdf"},
+			dir,
+			path.Join(dir, "report.pdf"),
+			true,
+		},
+		{
+			Source{Path: noExtURL, Size: 100, Ext: ".pdf", FileName: "summary"},
+			dir,
+			path.Join(dir, "summary.pdf"),
+			true,
+		},
+		{
+			Source{Path: scriptURL, Size: 100, Ext: ".bin", FileName: "report.pdf"},
+			f.Name(),
+			f.Name(),
+			true,
+		},
+		{
+			Source{Path: noExtURL, Size: 100, Ext: ".txt"},
 			"fakeDest",
 			"fakeDest",
 			false,
@@ -146,7 +181,7 @@ func TestResolveDest(t *testing.T) {
 			&mockClient{},
 		)
 
-		d, err := pr.resolveDest(&pathInfo.source)
+		d, _, err := pr.resolveDest(&pathInfo.source)
 		if err != nil {
 			if pathInfo.valid {
 				t.Errorf(
@@ -169,6 +204,58 @@ func TestResolveDest(t *testing.T) {
 	}
 }
 
+func TestResolveDestFile(t *testing.T) {
+	dir, f := initTmpStorage()
+	defer os.RemoveAll(dir)
+	f.Close()
+
+	testURL, _ := url.ParseRequestURI("http://source.com/file.txt")
+
+	pr := NewPathResolver(testURL.String(), path.Join(dir, "Makefile"), &mockClient{})
+	pr.DestFile = true
+
+	d, _, err := pr.resolveDest(&Source{Path: testURL, Ext: ".txt"})
+	assert.NoError(t, err)
+	assert.Equal(t, path.Join(dir, "Makefile"), d.Name())
+	_ = d.Close()
+
+	pr.Dest = path.Join(dir, "missing", "Makefile")
+	_, _, err = pr.resolveDest(&Source{Path: testURL, Ext: ".txt"})
+	assert.Error(t, err)
+}
+
+func TestResolveDestFileNameExists(t *testing.T) {
+	dir, f := initTmpStorage()
+	defer os.RemoveAll(dir)
+	f.Close()
+
+	scriptURL, _ := url.ParseRequestURI("http://source.com/download.php")
+	src := &Source{Path: scriptURL, Size: 100, Ext: ".bin", FileName: "report.pdf"}
+	existing := path.Join(dir, "report.pdf")
+
+	_ = ioutil.WriteFile(existing, []byte("keep"), 0666)
+
+	pr := NewPathResolver(scriptURL.String(), dir, &mockClient{})
+	_, _, err := pr.resolveDest(src)
+	assert.EqualError(
+		t,
+		err,
+		fmt.Sprintf("splitter: path resolver: refusing to overwrite file - %s: file already exists", existing),
+	)
+
+	content, _ := ioutil.ReadFile(existing)
+	assert.Equal(t, "keep", string(content))
+
+	// An interrupted download of the file is resumed.
+	_ = ioutil.WriteFile(existing+JournalSuffix, nil, 0666)
+
+	d, created, err := pr.resolveDest(src)
+	assert.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, existing, d.Name())
+	_ = d.Close()
+}
+
 func TestResolveDestError(t *testing.T) {
 	dir, f := initTmpStorage()
 	defer os.RemoveAll(dir)
@@ -177,7 +264,7 @@ func TestResolveDestError(t *testing.T) {
 
 	testURL, _ := url.ParseRequestURI("http://source.com/test")
 	pr := NewPathResolver(testURL.String(), f.Name(), nil)
-	_, err := pr.resolveDest(&Source{testURL, 100, ".txt", nil})
+	_, _, err := pr.resolveDest(&Source{Path: testURL, Size: 100, Ext: ".txt"})
 
 	assert.EqualError(
 		t,
@@ -202,7 +289,7 @@ func TestResolveDestSourceError(t *testing.T) {
 
 	testURL, _ := url.ParseRequestURI("http://source.com/file.txt")
 	pr := NewPathResolver(testURL.String(), dir, nil)
-	_, err = pr.resolveDest(&Source{testURL, 100, ".txt", nil})
+	_, _, err = pr.resolveDest(&Source{Path: testURL, Size: 100, Ext: ".txt"})
 
 	assert.EqualError(
 		t,
@@ -215,7 +302,7 @@ func TestResolveDestSourceError(t *testing.T) {
 }
 
 func prepareHttpClientResp() {
-	GetGetFunc = func(url string) (*http.Response, error) {
+	GetHeadFunc = func(url string) (*http.Response, error) {
 		return &http.Response{
 			StatusCode:    200,
 			Header:        http.Header{"Content-Type": []string{"image/jpeg"}},
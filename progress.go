@@ -0,0 +1,170 @@
+package splitter
+
+import (
+	"time"
+)
+
+// DefaultProgressInterval is the interval between periodic progress reports
+// when Splitter.ProgressInterval is not set.
+const DefaultProgressInterval = 500 * time.Millisecond
+
+// speedSmoothing is the weight of the latest throughput sample in the
+// exponential moving average of the download speed.
+const speedSmoothing = 0.3
+
+// ChunkState describes the life cycle of a single DownloadRange.
+type ChunkState int
+
+// Chunk states reported in ChunkProgress.
+const (
+	ChunkQueued ChunkState = iota
+	ChunkRunning
+	ChunkRetrying
+	ChunkDone
+	ChunkFailed
+)
+
+var chunkStateNames = [...]string{
+	ChunkQueued:   "queued",
+	ChunkRunning:  "running",
+	ChunkRetrying: "retrying",
+	ChunkDone:     "done",
+	ChunkFailed:   "failed",
+}
+
+func (cs ChunkState) String() string {
+	if cs < 0 || int(cs) >= len(chunkStateNames) {
+		return "unknown"
+	}
+
+	return chunkStateNames[cs]
+}
+
+// ChunkProgress is a snapshot of a single chunk of the download.
+type ChunkProgress struct {
+	Range   DownloadRange
+	Written int
+	State   ChunkState
+	Retries int
+}
+
+// Progress is a snapshot of a running download.
+type Progress struct {
+	// Total is the size of the source in bytes.
+	Total int
+
+	// Downloaded is the number of bytes written to the destination including
+	// bytes written before the download was resumed.
+	Downloaded int
+
+	// Speed is the smoothed download speed in bytes per second.
+	Speed float64
+
+	// ETA is the estimated time left. It is negative while the speed is
+	// unknown.
+	ETA time.Duration
+
+	// Chunks holds the state of every chunk ordered by creation. Chunks taken
+	// over by idle workers are appended at the end.
+	Chunks []ChunkProgress
+}
+
+// A progressReporter calls Splitter.OnProgress from a single goroutine every
+// interval and whenever a chunk changes its state.
+type progressReporter struct {
+	fn       func(Progress)
+	interval time.Duration
+	journal  *journal
+
+	notify chan struct{}
+	stopCh chan struct{}
+	done   chan struct{}
+
+	lastBytes int
+	lastTime  time.Time
+	speed     float64
+}
+
+// newProgressReporter creates and starts new progressReporter instance.
+func newProgressReporter(fn func(Progress), interval time.Duration, j *journal) *progressReporter {
+	if interval <= 0 {
+		interval = DefaultProgressInterval
+	}
+
+	pr := &progressReporter{
+		fn:       fn,
+		interval: interval,
+		journal:  j,
+		notify:   make(chan struct{}, 1),
+		stopCh:   make(chan struct{}),
+		done:     make(chan struct{}),
+		lastTime: time.Now(),
+	}
+	pr.lastBytes = j.progress().Downloaded
+
+	go pr.run()
+
+	return pr
+}
+
+// run reports progress until the reporter is stopped.
+func (pr *progressReporter) run() {
+	defer close(pr.done)
+
+	t := time.NewTicker(pr.interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+		case <-pr.notify:
+		case <-pr.stopCh:
+			pr.report()
+			return
+		}
+
+		pr.report()
+	}
+}
+
+// report builds a snapshot of the download and passes it to the callback.
+func (pr *progressReporter) report() {
+	p := pr.journal.progress()
+
+	now := time.Now()
+	if dt := now.Sub(pr.lastTime).Seconds(); dt >= pr.interval.Seconds()/2 {
+		sample := float64(p.Downloaded-pr.lastBytes) / dt
+		pr.speed = speedSmoothing*sample + (1-speedSmoothing)*pr.speed
+		pr.lastBytes, pr.lastTime = p.Downloaded, now
+	}
+
+	p.Speed = pr.speed
+	p.ETA = -1
+	if pr.speed > 0 {
+		p.ETA = time.Duration(float64(p.Total-p.Downloaded) / pr.speed * float64(time.Second))
+	}
+
+	pr.fn(p)
+}
+
+// changed requests an immediate report without blocking the caller.
+func (pr *progressReporter) changed() {
+	if pr == nil {
+		return
+	}
+
+	select {
+	case pr.notify <- struct{}{}:
+	default:
+	}
+}
+
+// stop sends the final report and waits for the reporter to exit.
+func (pr *progressReporter) stop() {
+	if pr == nil {
+		return
+	}
+
+	close(pr.stopCh)
+	<-pr.done
+}
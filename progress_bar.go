@@ -0,0 +1,336 @@
+package splitter
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultProgressBarWidth is the number of cells of the bar and the segment
+// map when ProgressBar.Width is not set.
+const DefaultProgressBarWidth = 50
+
+// DefaultLogInterval is the interval between progress lines written to
+// writers that are not terminals when ProgressBar.LogInterval is not set.
+const DefaultLogInterval = 5 * time.Second
+
+// Cells of the segment map.
+const (
+	cellEmpty    = '.'
+	cellPartial  = '+'
+	cellDone     = '#'
+	cellRetrying = '!'
+	cellFailed   = 'x'
+)
+
+// A ProgressBar renders progress reports of a Splitter. It is used as the
+// Splitter.OnProgress callback:
+//
+//	bar := splitter.NewProgressBar(os.Stderr, "file.iso")
+//	s.OnProgress = bar.Render
+//
+// On a terminal it redraws a live display with the overall bar, the segment
+// map of the file, speed, ETA and chunk states:
+//
+//	file.iso [==============>                   ]  42.0%  4.2 MiB / 10.0 MiB
+//	         [#######+....######+......#######+.]  1.3 MiB/s  ETA 0:04
+//	         chunks: 3 running, 1 retrying, 4 done, 8 retries
+//
+// A "#" cell of the map is downloaded, "+" is partially downloaded, "!" and
+// "x" are parts of retrying and failed chunks. Other writers get a plain line
+// every LogInterval and when the download completes.
+type ProgressBar struct {
+	// Width is the number of cells of the bar and the segment map.
+	// DefaultProgressBarWidth is used if it is zero.
+	Width int
+
+	// LogInterval is the interval between plain progress lines.
+	// DefaultLogInterval is used if it is zero.
+	LogInterval time.Duration
+
+	w    io.Writer
+	name string
+	tty  bool
+
+	mu      sync.Mutex
+	lines   int
+	lastLog time.Time
+	done    bool
+}
+
+// NewProgressBar creates new ProgressBar instance that writes to w. The
+// display is redrawn in place only if w is a terminal.
+func NewProgressBar(w io.Writer, name string) *ProgressBar {
+	return &ProgressBar{w: w, name: name, tty: isTerminal(w)}
+}
+
+// isTerminal reports whether the writer is a character device that handles
+// ANSI escape sequences.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+
+	fi, err := f.Stat()
+
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// Render draws the progress report.
+func (pb *ProgressBar) Render(p Progress) {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+
+	if pb.tty {
+		pb.draw(p)
+		return
+	}
+
+	complete := p.Total > 0 && p.Downloaded >= p.Total
+
+	switch {
+	case pb.done:
+		return
+	case complete:
+		pb.done = true
+	case time.Since(pb.lastLog) < pb.logInterval():
+		return
+	}
+
+	pb.lastLog = time.Now()
+
+	_, _ = fmt.Fprintf(
+		pb.w,
+		"%s: %s %s / %s, %s, ETA %s, %s\n",
+		pb.name,
+		formatPercent(p),
+		formatBytes(p.Downloaded),
+		formatBytes(p.Total),
+		formatSpeed(p.Speed),
+		formatETA(p.ETA),
+		chunkSummary(p),
+	)
+}
+
+// draw replaces the previous display on the terminal with the new one.
+func (pb *ProgressBar) draw(p Progress) {
+	var b strings.Builder
+
+	if pb.lines > 0 {
+		fmt.Fprintf(&b, "\x1b[%dA", pb.lines)
+	}
+
+	indent := strings.Repeat(" ", len(pb.name))
+	width := pb.width()
+
+	filled := 0
+	if p.Total > 0 {
+		filled = int(int64(p.Downloaded) * int64(width) / int64(p.Total))
+	}
+
+	bar := strings.Repeat("=", filled)
+	if filled < width {
+		bar += ">" + strings.Repeat(" ", width-filled-1)
+	}
+
+	lines := []string{
+		fmt.Sprintf(
+			"%s [%s] %6s  %s / %s",
+			pb.name, bar, formatPercent(p), formatBytes(p.Downloaded), formatBytes(p.Total),
+		),
+		fmt.Sprintf(
+			"%s [%s]  %s  ETA %s",
+			indent, segmentMap(p, width), formatSpeed(p.Speed), formatETA(p.ETA),
+		),
+		fmt.Sprintf("%s chunks: %s", indent, chunkSummary(p)),
+	}
+
+	for _, l := range lines {
+		b.WriteString("\x1b[2K")
+		b.WriteString(l)
+		b.WriteByte('\n')
+	}
+
+	pb.lines = len(lines)
+
+	_, _ = io.WriteString(pb.w, b.String())
+}
+
+func (pb *ProgressBar) width() int {
+	if pb.Width <= 0 {
+		return DefaultProgressBarWidth
+	}
+
+	return pb.Width
+}
+
+func (pb *ProgressBar) logInterval() time.Duration {
+	if pb.LogInterval <= 0 {
+		return DefaultLogInterval
+	}
+
+	return pb.LogInterval
+}
+
+// segmentMap returns a cell per 1/width of the file that shows how much of it
+// is downloaded.
+func segmentMap(p Progress, width int) string {
+	if p.Total <= 0 {
+		return strings.Repeat(string(cellEmpty), width)
+	}
+
+	done := make([]int64, width)
+	state := make([]ChunkState, width)
+
+	for _, c := range p.Chunks {
+		// Bytes of the chunk are written from its start, so the downloaded part
+		// is a single range.
+		addSpan(done, int64(c.Range.Start), int64(c.Range.Start+c.Written), int64(p.Total))
+
+		if c.State != ChunkRetrying && c.State != ChunkFailed {
+			continue
+		}
+
+		first, last := cellOf(c.Range.Start, p.Total, width), cellOf(c.Range.End-1, p.Total, width)
+		for i := first; i <= last; i++ {
+			state[i] = c.State
+		}
+	}
+
+	cells := make([]byte, width)
+	for i := range cells {
+		start, end := cellBounds(i, p.Total, width)
+
+		switch {
+		case start == end:
+			// Files smaller than the map leave cells without bytes.
+			cells[i] = cells[i-1]
+		case done[i] >= end-start:
+			cells[i] = cellDone
+		case state[i] == ChunkFailed:
+			cells[i] = cellFailed
+		case state[i] == ChunkRetrying:
+			cells[i] = cellRetrying
+		case done[i] > 0:
+			cells[i] = cellPartial
+		default:
+			cells[i] = cellEmpty
+		}
+	}
+
+	return string(cells)
+}
+
+// addSpan adds the bytes of the [start, end) span to the cells it overlaps.
+func addSpan(cells []int64, start, end, total int64) {
+	width := len(cells)
+
+	for i := cellOf(int(start), int(total), width); start < end && i < width; i++ {
+		_, cellEnd := cellBounds(i, int(total), width)
+
+		n := end - start
+		if cellEnd-start < n {
+			n = cellEnd - start
+		}
+
+		cells[i] += n
+		start += n
+	}
+}
+
+// cellOf returns the cell of the byte offset.
+func cellOf(offset, total, width int) int {
+	if offset < 0 {
+		return 0
+	}
+
+	i := int(int64(offset) * int64(width) / int64(total))
+	if i >= width {
+		return width - 1
+	}
+
+	return i
+}
+
+// cellBounds returns the byte range of the cell.
+func cellBounds(i, total, width int) (int64, int64) {
+	start := (int64(i)*int64(total) + int64(width) - 1) / int64(width)
+	end := (int64(i+1)*int64(total) + int64(width) - 1) / int64(width)
+
+	return start, end
+}
+
+// chunkSummary returns the number of chunks in every state that has any and
+// the total number of retries.
+func chunkSummary(p Progress) string {
+	var (
+		counts  [len(chunkStateNames)]int
+		retries int
+	)
+
+	for _, c := range p.Chunks {
+		if c.State >= 0 && int(c.State) < len(counts) {
+			counts[c.State]++
+		}
+
+		retries += c.Retries
+	}
+
+	var parts []string
+	for _, state := range []ChunkState{ChunkRunning, ChunkRetrying, ChunkQueued, ChunkFailed, ChunkDone} {
+		if counts[state] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[state], state))
+		}
+	}
+
+	parts = append(parts, fmt.Sprintf("%d retries", retries))
+
+	return strings.Join(parts, ", ")
+}
+
+func formatPercent(p Progress) string {
+	if p.Total <= 0 {
+		return "0.0%"
+	}
+
+	return fmt.Sprintf("%.1f%%", float64(p.Downloaded)*100/float64(p.Total))
+}
+
+// formatBytes formats the byte count with a binary unit.
+func formatBytes(n int) string {
+	const units = "KMGTPE"
+
+	if n < 1<<10 {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	v, i := float64(n)/(1<<10), 0
+	for v >= 1<<10 && i < len(units)-1 {
+		v /= 1 << 10
+		i++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", v, units[i])
+}
+
+func formatSpeed(speed float64) string {
+	return formatBytes(int(speed)) + "/s"
+}
+
+// formatETA formats the duration as [h:]mm:ss or "--:--" if it is unknown.
+func formatETA(d time.Duration) string {
+	if d < 0 {
+		return "--:--"
+	}
+
+	s := int((d + time.Second/2) / time.Second)
+	if s >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+	}
+
+	return fmt.Sprintf("%d:%02d", s/60, s%60)
+}
@@ -0,0 +1,84 @@
+package splitter
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSegmentMap(t *testing.T) {
+	p := Progress{
+		Total: 100,
+		Chunks: []ChunkProgress{
+			{Range: DownloadRange{0, 25}, Written: 25, State: ChunkDone},
+			{Range: DownloadRange{25, 50}, Written: 15, State: ChunkRunning},
+			{Range: DownloadRange{50, 75}, Written: 5, State: ChunkRetrying, Retries: 2},
+			{Range: DownloadRange{75, 100}, Written: 3, State: ChunkRunning},
+		},
+	}
+
+	assert.Equal(t, "########..#!!!!+....", segmentMap(p, 20))
+	assert.Equal(t, "##!!.", segmentMap(p, 5))
+
+	small := Progress{Total: 2, Chunks: []ChunkProgress{{Range: DownloadRange{0, 2}, Written: 1}}}
+	assert.Equal(t, "#####.....", segmentMap(small, 10))
+}
+
+func TestProgressBarTerminal(t *testing.T) {
+	var out bytes.Buffer
+
+	pb := &ProgressBar{Width: 10, w: &out, name: "file.bin", tty: true}
+	p := Progress{
+		Total:      1 << 20,
+		Downloaded: 1 << 19,
+		Speed:      1 << 18,
+		ETA:        2 * time.Second,
+		Chunks: []ChunkProgress{
+			{Range: DownloadRange{0, 1 << 19}, Written: 1 << 19, State: ChunkDone},
+			{Range: DownloadRange{1 << 19, 1 << 20}, State: ChunkRetrying, Retries: 1},
+		},
+	}
+
+	pb.Render(p)
+	assert.Equal(
+		t,
+		"\x1b[2Kfile.bin [=====>    ]  50.0%  512.0 KiB / 1.0 MiB\n"+
+			"\x1b[2K         [#####!!!!!]  256.0 KiB/s  ETA 0:02\n"+
+			"\x1b[2K         chunks: 1 retrying, 1 done, 1 retries\n",
+		out.String(),
+	)
+
+	out.Reset()
+	pb.Render(p)
+	assert.True(t, strings.HasPrefix(out.String(), "\x1b[3A\x1b[2K"))
+}
+
+func TestProgressBarLog(t *testing.T) {
+	var out bytes.Buffer
+
+	pb := NewProgressBar(&out, "file.bin")
+	pb.LogInterval = time.Hour
+
+	p := Progress{Total: 100, Downloaded: 40, ETA: -1, Chunks: []ChunkProgress{{State: ChunkRunning}}}
+	pb.Render(p)
+	pb.Render(p)
+
+	p.Downloaded, p.ETA, p.Chunks[0].State = 100, 0, ChunkDone
+	pb.Render(p)
+	pb.Render(p)
+
+	assert.Equal(
+		t,
+		"file.bin: 40.0% 40 B / 100 B, 0 B/s, ETA --:--, 1 running, 0 retries\n"+
+			"file.bin: 100.0% 100 B / 100 B, 0 B/s, ETA 0:00, 1 done, 0 retries\n",
+		out.String(),
+	)
+}
+
+func TestFormatETA(t *testing.T) {
+	assert.Equal(t, "1:05", formatETA(65*time.Second))
+	assert.Equal(t, "2:00:01", formatETA(2*time.Hour+time.Second))
+	assert.Equal(t, "--:--", formatETA(-1))
+}
@@ -0,0 +1,88 @@
+package splitter
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChunkStateString(t *testing.T) {
+	assert.Equal(t, "queued", ChunkQueued.String())
+	assert.Equal(t, "retrying", ChunkRetrying.String())
+	assert.Equal(t, "unknown", ChunkState(42).String())
+}
+
+func TestSplitterOnProgress(t *testing.T) {
+	dir, f := initTmpStorage()
+	defer os.RemoveAll(dir)
+
+	testURL, _ := url.ParseRequestURI("http://source.com/file.txt")
+	respond := rangeResponder("abcdefghijkl")
+
+	failed := false
+	GetDoFunc = func(req *http.Request) (*http.Response, error) {
+		if req.Header.Get("Range") == "bytes=0-5" && !failed {
+			failed = true
+			return &http.Response{
+				StatusCode:    206,
+				Header:        http.Header{"Content-Range": {"bytes 0-5/12"}},
+				Body:          ioutil.NopCloser(strings.NewReader("")),
+				ContentLength: -1,
+			}, nil
+		}
+
+		return respond(req)
+	}
+
+	var reports []Progress
+	s := NewSplitter(
+		context.Background(),
+		&PathInfo{Source: &Source{Path: testURL, Size: 12}, Dest: f},
+		2,
+		&mockClient{},
+	)
+	s.Workers = 1
+	s.Retry = NewRetryPolicy(2, time.Millisecond, time.Millisecond)
+	s.ProgressInterval = time.Hour
+	s.OnProgress = func(p Progress) {
+		reports = append(reports, p)
+	}
+
+	assert.NoError(t, s.Download())
+	assert.NotEmpty(t, reports)
+
+	for _, p := range reports {
+		assert.Equal(t, 12, p.Total)
+	}
+
+	last := reports[len(reports)-1]
+	assert.Equal(t, 12, last.Downloaded)
+	assert.Equal(t, []ChunkProgress{
+		{Range: DownloadRange{0, 6}, Written: 6, State: ChunkDone, Retries: 1},
+		{Range: DownloadRange{6, 12}, Written: 6, State: ChunkDone},
+	}, last.Chunks)
+}
+
+func TestProgressReporterSpeed(t *testing.T) {
+	j := &journal{Size: 100, Chunks: []*chunk{{Start: 0, End: 100}}}
+
+	var last Progress
+	pr := &progressReporter{
+		fn:       func(p Progress) { last = p },
+		interval: time.Second,
+		journal:  j,
+		lastTime: time.Now().Add(-time.Second),
+	}
+
+	j.Chunks[0].Written = 50
+	pr.report()
+
+	assert.InDelta(t, 50*speedSmoothing, last.Speed, 1)
+	assert.True(t, last.ETA > 0)
+}
@@ -0,0 +1,204 @@
+package splitter
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+)
+
+// A RangeSource fetches the content of a Source by byte ranges. Splitter
+// schedules chunks against it, so every RangeSource gets the same chunking,
+// retries, resume and verification.
+type RangeSource interface {
+	// Probe fills in the Size of the source and the metadata known to the
+	// protocol, e.g. Ext, validators and digests.
+	Probe(ctx context.Context, src *Source) error
+
+	// OpenRange opens a reader of the bytes of the DownloadRange. A reader
+	// that ends early fails the chunk with io.ErrUnexpectedEOF, extra bytes
+	// are ignored. An error wrapping ErrRangeNotSupported makes Splitter
+	// download the source with a single reader of the whole source, and an
+	// error wrapping ErrSourceChanged reports a modified source.
+	OpenRange(ctx context.Context, src *Source, dr DownloadRange) (io.ReadCloser, error)
+}
+
+// An HTTPSource is a RangeSource that fetches a source with GET requests
+// and the Range header.
+type HTTPSource struct {
+	Client HTTPClient
+}
+
+// Probe retrieves all necessary source attributes with a probe request.
+// Specifically it tries to fetch source size, content type, extension, file
+// name, range support, validators and digests and fills up Source struct. If
+// size or content type is unavailable then error will be returned.
+func (hs *HTTPSource) Probe(ctx context.Context, src *Source) error {
+	resp, err := hs.probe(ctx, src)
+	if err != nil {
+		return &SourceError{
+			context: "cannot fetch source info",
+			err:     err,
+		}
+	}
+
+	src.Size = int(resp.ContentLength)
+	src.AcceptRanges = resp.Header.Get("Accept-Ranges") == "bytes"
+	src.ETag = resp.Header.Get("ETag")
+	src.LastModified = resp.Header.Get("Last-Modified")
+	src.FileName = dispositionFileName(resp.Header.Get("Content-Disposition"))
+	src.Digests = digestsFromHeader(
+		resp.Header,
+		resp.StatusCode == http.StatusOK,
+	)
+
+	src.FinalURL = src.Path
+	if resp.Request != nil && resp.Request.URL != nil {
+		src.FinalURL = resp.Request.URL
+	}
+
+	if resp.StatusCode == http.StatusPartialContent {
+		src.AcceptRanges = true
+
+		_, _, total, err := parseContentRange(resp.Header.Get("Content-Range"))
+		if err != nil {
+			return &SourceError{context: "cannot fetch content length", err: err}
+		}
+
+		src.Size = total
+	}
+
+	if src.Size <= 0 {
+		return &SourceError{context: "cannot fetch content length"}
+	}
+
+	ct, err := mime.ExtensionsByType(resp.Header.Get("Content-Type"))
+	if len(ct) == 0 || err != nil {
+		return &SourceError{
+			context: "cannot fetch content type",
+			err:     err,
+		}
+	}
+
+	src.Ext = ct[0]
+
+	return nil
+}
+
+// probe requests the source headers with HEAD. If the server rejects HEAD or
+// does not report the content length, only the first byte of the source is
+// requested with GET instead. The response body is always closed, so nothing
+// but headers is transferred. Both requests are cancelled with the context.
+func (hs *HTTPSource) probe(ctx context.Context, src *Source) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, src.Path.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := hs.Client.Do(req)
+	if err == nil {
+		closeBody(resp)
+
+		if resp.StatusCode == http.StatusOK && resp.ContentLength > 0 {
+			return resp, nil
+		}
+	}
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, src.Path.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Range", "bytes=0-0")
+
+	resp, err = hs.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	closeBody(resp)
+
+	if resp.StatusCode != http.StatusOK &&
+		resp.StatusCode != http.StatusPartialContent {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return resp, nil
+}
+
+// OpenRange performs a new request for the DownloadRange and returns the
+// response body. The response must hold exactly the requested bytes,
+// otherwise ResponseError is returned.
+func (hs *HTTPSource) OpenRange(ctx context.Context, src *Source, dr DownloadRange) (io.ReadCloser, error) {
+	r, err := newRangeRequest(ctx, src, dr)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := hs.Client.Do(r)
+	if err != nil {
+		return nil, &splitterError{
+			context: "chunk download error",
+			err:     err,
+		}
+	}
+
+	if err := checkChunkResponse(response, dr, src); err != nil {
+		closeBody(response)
+		return nil, err
+	}
+
+	return response.Body, nil
+}
+
+// redirect resolves the redirects of the source Path again and returns the
+// final URL.
+func (hs *HTTPSource) redirect(ctx context.Context, src *Source) (*url.URL, error) {
+	resp, err := hs.probe(ctx, src)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.Request == nil || resp.Request.URL == nil {
+		return src.Path, nil
+	}
+
+	return resp.Request.URL, nil
+}
+
+// newRangeRequest make new request to the final URL of the target source with
+// provided DownloadRange info. Request will use "Range" header to download
+// specific chunk of source and "If-Range" header with the source validator, so
+// a modified source is sent in full instead of a mismatched range.
+func newRangeRequest(ctx context.Context, src *Source, dr DownloadRange) (*http.Request, error) {
+	request, err := http.NewRequestWithContext(
+		ctx,
+		"GET",
+		src.chunkURL().String(),
+		nil,
+	)
+	if err != nil {
+		return nil, &splitterError{context: "cannot prepare request", err: err}
+	}
+
+	request.Header.Add("Range", dr.BuildRangeHeader())
+
+	if v := src.Validator(); v != "" {
+		request.Header.Add("If-Range", v)
+	}
+
+	return request, nil
+}
+
+// closeBody closes the response body if there is any.
+func closeBody(resp *http.Response) {
+	if resp.Body != nil {
+		_ = resp.Body.Close()
+	}
+}
@@ -0,0 +1,138 @@
+package splitter
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memorySource is a RangeSource test double serving content from memory.
+// Every range reader is cut after limit bytes if limit is positive.
+type memorySource struct {
+	content string
+	limit   int
+
+	mu     sync.Mutex
+	ranges []DownloadRange
+}
+
+func (ms *memorySource) Probe(ctx context.Context, src *Source) error {
+	src.Size = len(ms.content)
+	src.Ext = ".txt"
+
+	return nil
+}
+
+func (ms *memorySource) OpenRange(ctx context.Context, src *Source, dr DownloadRange) (io.ReadCloser, error) {
+	ms.mu.Lock()
+	ms.ranges = append(ms.ranges, dr)
+	ms.mu.Unlock()
+
+	end := dr.End
+	if ms.limit > 0 && dr.Start+ms.limit < end {
+		end = dr.Start + ms.limit
+	}
+
+	return ioutil.NopCloser(strings.NewReader(ms.content[dr.Start:end])), nil
+}
+
+func TestSourceBackendProbe(t *testing.T) {
+	src := &Source{Backend: &memorySource{content: "abcdef"}}
+
+	assert.NoError(t, src.enrichSourceInfo(context.Background()))
+	assert.Equal(t, 6, src.Size)
+	assert.Equal(t, ".txt", src.Ext)
+}
+
+func TestSplitterRangeSource(t *testing.T) {
+	dir, f := initTmpStorage()
+	defer os.RemoveAll(dir)
+
+	testURL, _ := url.Parse("mem://file.txt")
+	ms := &memorySource{content: "abcdefghijkl", limit: 2}
+
+	s := NewSplitter(
+		context.Background(),
+		&PathInfo{Source: &Source{Path: testURL, Size: 12, Backend: ms}, Dest: f},
+		2,
+		nil,
+	)
+	s.Retry = NewRetryPolicy(2, time.Millisecond, time.Millisecond)
+
+	assert.NoError(t, s.Download())
+	assert.Len(t, ms.ranges, 6)
+
+	content, _ := ioutil.ReadFile(f.Name())
+	assert.Equal(t, "abcdefghijkl", string(content))
+}
+
+func TestHTTPSourceFinalURL(t *testing.T) {
+	path, _ := url.Parse("http://source.com/file.txt")
+	final, _ := url.Parse("https://cdn.com/file.txt?sig=abc")
+
+	var hosts []string
+	GetDoFunc = func(req *http.Request) (*http.Response, error) {
+		hosts = append(hosts, req.URL.Host)
+		assert.Empty(t, req.Header.Get("Authorization"))
+
+		return rangeResponder("abcdef")(req)
+	}
+
+	src := &Source{
+		Path:     path,
+		FinalURL: final,
+		Size:     6,
+		Request:  &RequestOptions{BearerToken: "token"},
+	}
+
+	body, err := src.backend(&mockClient{}).OpenRange(context.Background(), src, DownloadRange{Start: 1, End: 3})
+	assert.NoError(t, err)
+
+	data, _ := ioutil.ReadAll(body)
+	assert.Equal(t, "bc", string(data))
+	assert.Equal(t, []string{"cdn.com"}, hosts)
+}
+
+func TestHTTPSourceProbeFileName(t *testing.T) {
+	GetHeadFunc = func(url string) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: 200,
+			Header: http.Header{
+				"Content-Type":        {"application/pdf"},
+				"Content-Disposition": {`attachment; filename="../report.pdf"; filename*=UTF-8''%C3%BCbersicht.pdf`},
+			},
+			ContentLength: 100,
+		}, nil
+	}
+
+	u, _ := url.Parse("http://source.com/download.php?id=1")
+
+	src, err := NewSource(u, &mockClient{})
+	assert.NoError(t, err)
+	assert.Equal(t, "übersicht.pdf", src.FileName)
+}
+
+func TestHTTPSourceProbeCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var methods []string
+	client := funcClient(func(req *http.Request) (*http.Response, error) {
+		methods = append(methods, req.Method)
+		return nil, req.Context().Err()
+	})
+
+	u, _ := url.Parse("http://source.com/file.txt")
+
+	err := (&HTTPSource{Client: client}).Probe(ctx, &Source{Path: u})
+	assert.EqualError(t, err, "splitter: source: cannot fetch source info: context canceled")
+	assert.Equal(t, []string{http.MethodHead}, methods)
+}
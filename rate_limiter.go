@@ -0,0 +1,137 @@
+package splitter
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// A RateLimiter is a token bucket that caps the number of bytes per second
+// passing through it. The bucket holds up to one second worth of tokens. A
+// single RateLimiter may be shared by several chunks or Splitter instances to
+// cap their aggregate bandwidth, and its limit may be changed at any time.
+type RateLimiter struct {
+	mu     sync.Mutex
+	limit  int
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter creates new RateLimiter instance with the limit in bytes per
+// second. Zero or negative limit means unlimited bandwidth.
+func NewRateLimiter(bytesPerSec int) *RateLimiter {
+	return &RateLimiter{
+		limit:  bytesPerSec,
+		tokens: float64(bytesPerSec),
+		last:   time.Now(),
+	}
+}
+
+// Limit returns the current limit in bytes per second.
+func (rl *RateLimiter) Limit() int {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	return rl.limit
+}
+
+// SetLimit changes the limit in bytes per second. It affects downloads that
+// are already in progress. Zero or negative limit means unlimited bandwidth.
+func (rl *RateLimiter) SetLimit(bytesPerSec int) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.refill(time.Now())
+	rl.limit = bytesPerSec
+	if rl.tokens > float64(bytesPerSec) {
+		rl.tokens = float64(bytesPerSec)
+	}
+}
+
+// WaitN blocks until n bytes may pass or the context is done. Requests larger
+// than the bucket are allowed and paid off by the following ones.
+func (rl *RateLimiter) WaitN(ctx context.Context, n int) error {
+	rl.mu.Lock()
+
+	if rl.limit <= 0 {
+		rl.mu.Unlock()
+		return nil
+	}
+
+	now := time.Now()
+	rl.refill(now)
+	rl.tokens -= float64(n)
+
+	var wait time.Duration
+	if rl.tokens < 0 {
+		wait = time.Duration(-rl.tokens / float64(rl.limit) * float64(time.Second))
+	}
+
+	rl.mu.Unlock()
+
+	if wait == 0 {
+		return nil
+	}
+
+	t := time.NewTimer(wait)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		rl.mu.Lock()
+		rl.tokens += float64(n)
+		rl.mu.Unlock()
+
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// refill adds tokens for the time passed since the last refill. rl.mu must be
+// held.
+func (rl *RateLimiter) refill(now time.Time) {
+	if rl.limit > 0 {
+		rl.tokens += now.Sub(rl.last).Seconds() * float64(rl.limit)
+		if rl.tokens > float64(rl.limit) {
+			rl.tokens = float64(rl.limit)
+		}
+	}
+
+	rl.last = now
+}
+
+// throttledReader waits for the global and the per-connection limiters after
+// each read from the underlying reader. The per-connection limit is reloaded
+// on every read so it can be changed while the reader is in use.
+type throttledReader struct {
+	ctx       context.Context
+	r         io.Reader
+	global    *RateLimiter
+	conn      *RateLimiter
+	connLimit func() int
+}
+
+func (tr *throttledReader) Read(p []byte) (int, error) {
+	n, err := tr.r.Read(p)
+	if n <= 0 {
+		return n, err
+	}
+
+	if tr.global != nil {
+		if wErr := tr.global.WaitN(tr.ctx, n); wErr != nil {
+			return n, wErr
+		}
+	}
+
+	if l := tr.connLimit(); l != tr.conn.Limit() {
+		tr.conn.SetLimit(l)
+	}
+
+	if wErr := tr.conn.WaitN(tr.ctx, n); wErr != nil {
+		return n, wErr
+	}
+
+	return n, err
+}
@@ -0,0 +1,72 @@
+package splitter
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterWaitN(t *testing.T) {
+	rl := NewRateLimiter(10000)
+	ctx := context.Background()
+
+	start := time.Now()
+	assert.NoError(t, rl.WaitN(ctx, 10000))
+	assert.True(t, time.Since(start) < 50*time.Millisecond)
+
+	assert.NoError(t, rl.WaitN(ctx, 1000))
+	assert.True(t, time.Since(start) >= 90*time.Millisecond)
+}
+
+func TestRateLimiterSetLimit(t *testing.T) {
+	rl := NewRateLimiter(10)
+	ctx := context.Background()
+	assert.NoError(t, rl.WaitN(ctx, 10))
+
+	rl.SetLimit(0)
+	assert.Equal(t, 0, rl.Limit())
+
+	start := time.Now()
+	assert.NoError(t, rl.WaitN(ctx, 1000))
+	assert.True(t, time.Since(start) < 50*time.Millisecond)
+}
+
+func TestRateLimiterWaitNCanceled(t *testing.T) {
+	rl := NewRateLimiter(1)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	assert.Equal(t, context.DeadlineExceeded, rl.WaitN(ctx, 100))
+}
+
+func TestSplitterRateLimit(t *testing.T) {
+	dir, f := initTmpStorage()
+	defer os.RemoveAll(dir)
+
+	testURL, _ := url.ParseRequestURI("http://source.com/file.txt")
+	content := strings.Repeat("a", 3000)
+	GetDoFunc = rangeResponder(content)
+
+	s := NewSplitter(
+		context.Background(),
+		&PathInfo{Source: &Source{Path: testURL, Size: 3000}, Dest: f},
+		3,
+		&mockClient{},
+	)
+	s.RateLimit = NewRateLimiter(20000)
+	s.SetConnRateLimit(2000)
+
+	start := time.Now()
+	assert.NoError(t, s.Download())
+
+	// Every connection downloads 1000 bytes at 2000 bytes per second.
+	assert.True(t, time.Since(start) >= 450*time.Millisecond)
+
+	written, _ := ioutil.ReadFile(f.Name())
+	assert.Equal(t, content, string(written))
+}
@@ -0,0 +1,197 @@
+package splitter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// httpOnlyPrefix marks HttpOnly cookies in cookies.txt files.
+const httpOnlyPrefix = "#HttpOnly_"
+
+// RequestOptions customizes every HTTP request of a download: the probe and
+// all chunk requests. Headers already set on a request, e.g. Range, are never
+// replaced. Like redirects followed by http.Client, chunk requests to another
+// host than the one of Source.Path, e.g. the final URL of a redirect to a CDN,
+// carry no Authorization and Cookie headers and no Basic, Bearer or Netrc
+// credentials. Cookies of that host are still sent.
+type RequestOptions struct {
+	// Header holds static headers sent with every request.
+	Header http.Header
+
+	UserAgent string
+	Referer   string
+
+	// Username and Password are sent with Basic authentication if Username
+	// is set.
+	Username string
+	Password string
+
+	// BearerToken is sent with Bearer authentication. It takes precedence
+	// over Username.
+	BearerToken string
+
+	// Cookies provides the cookies of every request, see LoadCookies.
+	Cookies http.CookieJar
+
+	// Netrc provides Basic authentication credentials by the host of
+	// Source.Path. It is used only if no other credentials are set,
+	// including the user info of the URL.
+	Netrc *Netrc
+
+	// host restricts the credentials to the host if it is not empty.
+	host string
+}
+
+// client returns the client that applies the options to every request of c.
+// It returns c if the options are nil. Only options restricted with forHost
+// are wrapped, so the credentials never leave the source host.
+func (ro *RequestOptions) client(c HTTPClient) HTTPClient {
+	if ro == nil {
+		return c
+	}
+
+	return &requestClient{client: c, options: ro}
+}
+
+// forHost returns a copy of the options that sends the credentials to the host
+// only.
+func (ro *RequestOptions) forHost(host string) *RequestOptions {
+	if ro == nil {
+		return nil
+	}
+
+	c := *ro
+	c.host = host
+
+	return &c
+}
+
+// apply adds the options to the request.
+func (ro *RequestOptions) apply(req *http.Request) {
+	trusted := ro.host == "" || strings.EqualFold(req.URL.Host, ro.host)
+
+	for k, v := range ro.Header {
+		if !trusted && (k == "Authorization" || k == "Cookie") {
+			continue
+		}
+
+		if _, ok := req.Header[k]; !ok {
+			req.Header[k] = v
+		}
+	}
+
+	setDefault(req.Header, "User-Agent", ro.UserAgent)
+	setDefault(req.Header, "Referer", ro.Referer)
+
+	switch {
+	case req.Header.Get("Authorization") != "":
+	case trusted && ro.BearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+ro.BearerToken)
+	case trusted && ro.Username != "":
+		req.SetBasicAuth(ro.Username, ro.Password)
+	case req.URL.User != nil:
+	case trusted:
+		if login, password, ok := ro.Netrc.Credentials(req.URL.Hostname()); ok {
+			req.SetBasicAuth(login, password)
+		}
+	}
+
+	if ro.Cookies != nil && req.Header.Get("Cookie") == "" {
+		for _, c := range ro.Cookies.Cookies(req.URL) {
+			req.AddCookie(c)
+		}
+	}
+}
+
+// setDefault sets the header if it is not empty and the request has no such
+// header yet.
+func setDefault(h http.Header, key, value string) {
+	if value != "" && h.Get(key) == "" {
+		h.Set(key, value)
+	}
+}
+
+// LoadCookies reads cookies in the Netscape cookies.txt format exported by
+// browsers and curl. Every line holds the tab separated domain, subdomain
+// flag, path, secure flag, expiration time, name and value of a cookie.
+// Expired cookies are dropped.
+func LoadCookies(r io.Reader) (http.CookieJar, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+
+		httpOnly := strings.HasPrefix(text, httpOnlyPrefix)
+		if httpOnly {
+			text = text[len(httpOnlyPrefix):]
+		}
+
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		u, c, err := parseCookie(text)
+		if err != nil {
+			return nil, &splitterError{
+				context: fmt.Sprintf("invalid cookie on line %d", line),
+				err:     err,
+			}
+		}
+
+		c.HttpOnly = httpOnly
+		jar.SetCookies(u, []*http.Cookie{c})
+	}
+
+	if err := sc.Err(); err != nil {
+		return nil, &splitterError{context: "cannot read cookies", err: err}
+	}
+
+	return jar, nil
+}
+
+// parseCookie parses a cookies.txt line and returns the cookie with the URL
+// it was set by.
+func parseCookie(line string) (*url.URL, *http.Cookie, error) {
+	fields := strings.Split(line, "\t")
+	if len(fields) != 7 {
+		return nil, nil, fmt.Errorf("expected 7 fields, got %d", len(fields))
+	}
+
+	expires, err := strconv.ParseInt(fields[4], 10, 64)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	host := strings.TrimPrefix(fields[0], ".")
+	secure := strings.EqualFold(fields[3], "TRUE")
+
+	u := &url.URL{Scheme: "http", Host: host, Path: fields[2]}
+	if secure {
+		u.Scheme = "https"
+	}
+
+	c := &http.Cookie{Name: fields[5], Value: fields[6], Path: fields[2], Secure: secure}
+
+	// The jar sends host-only cookies to the exact host only.
+	if strings.EqualFold(fields[1], "TRUE") {
+		c.Domain = host
+	}
+
+	// Zero is a session cookie.
+	if expires != 0 {
+		c.Expires = time.Unix(expires, 0)
+	}
+
+	return u, c, nil
+}
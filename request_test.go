@@ -0,0 +1,174 @@
+package splitter
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// funcClient is an HTTPClient that sends all requests, including the ones of
+// Get, with the function.
+type funcClient func(req *http.Request) (*http.Response, error)
+
+func (fc funcClient) Do(req *http.Request) (*http.Response, error) {
+	return fc(req)
+}
+
+func (fc funcClient) Get(url string) (*http.Response, error) {
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	return fc(req)
+}
+
+func TestRequestOptionsApply(t *testing.T) {
+	jar, err := LoadCookies(strings.NewReader(".example.com\tTRUE\t/\tFALSE\t0\tsession\tabc\n"))
+	assert.NoError(t, err)
+
+	ro := &RequestOptions{
+		Header:      http.Header{"X-Trace": {"1"}, "Range": {"bytes=0-"}},
+		UserAgent:   "splitter-test",
+		Referer:     "http://example.com/",
+		Username:    "user",
+		Password:    "secret",
+		BearerToken: "token",
+		Cookies:     jar,
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "http://cdn.example.com/file.bin", nil)
+	req.Header.Set("Range", "bytes=10-20")
+	ro.apply(req)
+
+	assert.Equal(t, "1", req.Header.Get("X-Trace"))
+	assert.Equal(t, "bytes=10-20", req.Header.Get("Range"))
+	assert.Equal(t, "splitter-test", req.Header.Get("User-Agent"))
+	assert.Equal(t, "http://example.com/", req.Header.Get("Referer"))
+	assert.Equal(t, "Bearer token", req.Header.Get("Authorization"))
+	assert.Equal(t, "session=abc", req.Header.Get("Cookie"))
+
+	ro.BearerToken = ""
+	req, _ = http.NewRequest(http.MethodGet, "http://other.com/file.bin", nil)
+	ro.apply(req)
+
+	user, password, ok := req.BasicAuth()
+	assert.True(t, ok)
+	assert.Equal(t, "user", user)
+	assert.Equal(t, "secret", password)
+	assert.Empty(t, req.Header.Get("Cookie"))
+
+	var nilOptions *RequestOptions
+	client := &mockClient{}
+	assert.Equal(t, client, nilOptions.client(client))
+}
+
+func TestRequestOptionsForHost(t *testing.T) {
+	ro := (&RequestOptions{
+		Header:   http.Header{"Authorization": {"Token abc"}, "X-Trace": {"1"}},
+		Username: "user",
+	}).forHost("source.com")
+
+	req, _ := http.NewRequest(http.MethodGet, "http://source.com/file.bin", nil)
+	ro.apply(req)
+	assert.Equal(t, "Token abc", req.Header.Get("Authorization"))
+
+	req, _ = http.NewRequest(http.MethodGet, "http://cdn.com/file.bin", nil)
+	ro.apply(req)
+	assert.Empty(t, req.Header.Get("Authorization"))
+	assert.Equal(t, "1", req.Header.Get("X-Trace"))
+
+	n, err := ParseNetrc(strings.NewReader("machine source.com login user password secret\ndefault login anonymous password guest"))
+	assert.NoError(t, err)
+
+	ro = (&RequestOptions{Netrc: n}).forHost("source.com")
+
+	req, _ = http.NewRequest(http.MethodGet, "http://source.com/file.bin", nil)
+	ro.apply(req)
+
+	user, password, ok := req.BasicAuth()
+	assert.True(t, ok)
+	assert.Equal(t, "user", user)
+	assert.Equal(t, "secret", password)
+
+	req, _ = http.NewRequest(http.MethodGet, "http://cdn.com/file.bin", nil)
+	ro.apply(req)
+	assert.Empty(t, req.Header.Get("Authorization"))
+}
+
+func TestLoadCookies(t *testing.T) {
+	input := `# Netscape HTTP Cookie File
+.example.com	TRUE	/	FALSE	0	domain	1
+host.com	FALSE	/files	TRUE	4102444800	secure	2
+#HttpOnly_host.com	FALSE	/	FALSE	0	http_only	3
+host.com	FALSE	/	FALSE	1	expired	4
+`
+
+	jar, err := LoadCookies(strings.NewReader(input))
+	assert.NoError(t, err)
+
+	cookies := func(raw string) []string {
+		u, _ := url.Parse(raw)
+
+		var names []string
+		for _, c := range jar.Cookies(u) {
+			names = append(names, c.Name+"="+c.Value)
+		}
+
+		return names
+	}
+
+	assert.Equal(t, []string{"domain=1"}, cookies("http://www.example.com/"))
+	assert.Equal(t, []string{"secure=2", "http_only=3"}, cookies("https://host.com/files/a.bin"))
+	assert.Equal(t, []string{"http_only=3"}, cookies("http://host.com/files/a.bin"))
+	assert.Empty(t, cookies("http://sub.host.com/"))
+
+	_, err = LoadCookies(strings.NewReader("host.com\tFALSE\t/\n"))
+	assert.EqualError(t, err, "splitter: invalid cookie on line 1: expected 7 fields, got 3")
+}
+
+func TestPathResolverRequestOptions(t *testing.T) {
+	dir, f := initTmpStorage()
+	defer os.RemoveAll(dir)
+	f.Close()
+
+	respond := rangeResponder("abcdefghijkl")
+
+	var (
+		mu       sync.Mutex
+		requests []*http.Request
+	)
+
+	client := funcClient(func(req *http.Request) (*http.Response, error) {
+		mu.Lock()
+		requests = append(requests, req)
+		mu.Unlock()
+
+		if req.Method == http.MethodHead {
+			return &http.Response{
+				StatusCode:    200,
+				Header:        http.Header{"Content-Type": {"text/plain"}},
+				ContentLength: 12,
+			}, nil
+		}
+
+		return respond(req)
+	})
+
+	pr := NewPathResolver("http://source.com/file.txt", filepath.Join(dir, "dest_file.txt"), client)
+	pr.Request = &RequestOptions{UserAgent: "splitter-test", BearerToken: "token"}
+
+	pi, err := pr.PathInfo()
+	assert.NoError(t, err)
+	defer pi.Dest.Close()
+
+	assert.NoError(t, NewSplitter(context.Background(), pi, 3, client).Download())
+	assert.Len(t, requests, 4)
+
+	for _, req := range requests {
+		assert.Equal(t, "splitter-test", req.Header.Get("User-Agent"), req.Method)
+		assert.Equal(t, "Bearer token", req.Header.Get("Authorization"), req.Method)
+	}
+}
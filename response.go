@@ -0,0 +1,149 @@
+package splitter
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ErrSourceChanged is the error wrapped by errors returned when the source was
+// modified during the download or since the journal was written.
+var ErrSourceChanged = errors.New("source changed")
+
+// ErrRangeNotSupported is the error wrapped by ResponseError when the server
+// ignores the Range header of a chunk request.
+var ErrRangeNotSupported = errors.New("range requests are not supported")
+
+// A ResponseError is returned when a chunk response cannot be written to the
+// destination because it does not match the requested DownloadRange.
+type ResponseError struct {
+	StatusCode int
+	Range      DownloadRange
+	Reason     string
+	err        error
+}
+
+func (re *ResponseError) Error() string {
+	return fmt.Sprintf(
+		"splitter: response to %s: %s",
+		re.Range.BuildRangeHeader(),
+		re.Reason,
+	)
+}
+
+func (re *ResponseError) Unwrap() error {
+	return re.err
+}
+
+// Temporary reports whether the server may answer properly on a retry.
+func (re *ResponseError) Temporary() bool {
+	return re.StatusCode == http.StatusRequestTimeout ||
+		re.StatusCode == http.StatusTooManyRequests ||
+		re.StatusCode >= http.StatusInternalServerError
+}
+
+// checkChunkResponse validates that the response holds exactly the bytes of
+// the requested DownloadRange of the source and comes from the same version of
+// the source. A 200 response is accepted only for ranges starting at the
+// beginning of the source, in which case the requested bytes are a prefix of
+// the body.
+func checkChunkResponse(resp *http.Response, dr DownloadRange, src *Source) error {
+	if (resp.StatusCode == http.StatusOK ||
+		resp.StatusCode == http.StatusPartialContent) &&
+		src.changedSince(resp.Header) {
+		return &ResponseError{
+			StatusCode: resp.StatusCode,
+			Range:      dr,
+			Reason:     ErrSourceChanged.Error(),
+			err:        ErrSourceChanged,
+		}
+	}
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		if dr.Start == 0 {
+			return nil
+		}
+
+		return &ResponseError{
+			StatusCode: resp.StatusCode,
+			Range:      dr,
+			Reason:     ErrRangeNotSupported.Error(),
+			err:        ErrRangeNotSupported,
+		}
+	default:
+		return &ResponseError{
+			StatusCode: resp.StatusCode,
+			Range:      dr,
+			Reason:     "unexpected status " + resp.Status,
+		}
+	}
+
+	cr := resp.Header.Get("Content-Range")
+
+	start, end, total, err := parseContentRange(cr)
+	if err != nil {
+		return &ResponseError{
+			StatusCode: resp.StatusCode,
+			Range:      dr,
+			Reason:     err.Error(),
+		}
+	}
+
+	if start != dr.Start || end != dr.End || (total >= 0 && total != src.Size) {
+		return &ResponseError{
+			StatusCode: resp.StatusCode,
+			Range:      dr,
+			Reason:     fmt.Sprintf("mismatched Content-Range %q", cr),
+		}
+	}
+
+	if resp.ContentLength >= 0 && resp.ContentLength != int64(dr.End-dr.Start) {
+		return &ResponseError{
+			StatusCode: resp.StatusCode,
+			Range:      dr,
+			Reason:     fmt.Sprintf("mismatched Content-Length %d", resp.ContentLength),
+		}
+	}
+
+	return nil
+}
+
+// parseContentRange parses the "bytes first-last/total" Content-Range header
+// value. The returned end is exclusive like DownloadRange.End and total is -1
+// if the complete length is unknown.
+func parseContentRange(cr string) (start, end, total int, err error) {
+	invalid := fmt.Errorf("invalid Content-Range %q", cr)
+
+	if !strings.HasPrefix(cr, "bytes ") {
+		return 0, 0, 0, invalid
+	}
+
+	spec := strings.TrimPrefix(cr, "bytes ")
+
+	slash := strings.IndexByte(spec, '/')
+	dash := strings.IndexByte(spec, '-')
+	if slash < 0 || dash < 0 || dash > slash {
+		return 0, 0, 0, invalid
+	}
+
+	if start, err = strconv.Atoi(spec[:dash]); err != nil {
+		return 0, 0, 0, invalid
+	}
+
+	if end, err = strconv.Atoi(spec[dash+1 : slash]); err != nil || end < start {
+		return 0, 0, 0, invalid
+	}
+
+	total = -1
+	if spec[slash+1:] != "*" {
+		if total, err = strconv.Atoi(spec[slash+1:]); err != nil {
+			return 0, 0, 0, invalid
+		}
+	}
+
+	return start, end + 1, total, nil
+}
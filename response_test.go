@@ -0,0 +1,168 @@
+package splitter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParseContentRange(t *testing.T) {
+	start, end, total, err := parseContentRange("bytes 10-19/100")
+	assert.NoError(t, err)
+	assert.Equal(t, []int{10, 20, 100}, []int{start, end, total})
+
+	_, _, total, err = parseContentRange("bytes 0-0/*")
+	assert.NoError(t, err)
+	assert.Equal(t, -1, total)
+
+	for _, cr := range []string{"", "bytes */100", "bytes 5-1/10", "items 0-1/2"} {
+		_, _, _, err = parseContentRange(cr)
+		assert.Error(t, err, cr)
+	}
+}
+
+func TestCheckChunkResponse(t *testing.T) {
+	dr := DownloadRange{Start: 10, End: 20}
+
+	responseTests := []struct {
+		status       int
+		contentRange string
+		length       int64
+		err          string
+	}{
+		{206, "bytes 10-19/100", 10, ""},
+		{206, "bytes 10-19/*", -1, ""},
+		{206, "bytes 0-19/100", 20, `splitter: response to bytes=10-19: mismatched Content-Range "bytes 0-19/100"`},
+		{206, "bytes 10-19/200", 10, `splitter: response to bytes=10-19: mismatched Content-Range "bytes 10-19/200"`},
+		{206, "bytes 10-19/100", 100, "splitter: response to bytes=10-19: mismatched Content-Length 100"},
+		{206, "", 10, `splitter: response to bytes=10-19: invalid Content-Range ""`},
+		{200, "", 100, "splitter: response to bytes=10-19: range requests are not supported"},
+		{404, "", 0, "splitter: response to bytes=10-19: unexpected status 404 Not Found"},
+	}
+
+	for _, rt := range responseTests {
+		resp := &http.Response{
+			StatusCode:    rt.status,
+			Status:        fmt.Sprintf("%d %s", rt.status, http.StatusText(rt.status)),
+			Header:        http.Header{"Content-Range": {rt.contentRange}},
+			ContentLength: rt.length,
+		}
+
+		err := checkChunkResponse(resp, dr, &Source{Size: 100})
+		if rt.err == "" {
+			assert.NoError(t, err)
+			continue
+		}
+
+		assert.EqualError(t, err, rt.err)
+	}
+
+	err := checkChunkResponse(&http.Response{StatusCode: 200}, dr, &Source{Size: 100})
+	assert.True(t, errors.Is(err, ErrRangeNotSupported))
+
+	err = checkChunkResponse(&http.Response{StatusCode: 200}, DownloadRange{0, 10}, &Source{Size: 100})
+	assert.NoError(t, err)
+}
+
+func TestSplitterSingleStreamFallback(t *testing.T) {
+	dir, f := initTmpStorage()
+	defer os.RemoveAll(dir)
+
+	testURL, _ := url.ParseRequestURI("http://source.com/file.txt")
+
+	var mu sync.Mutex
+	var ranges []string
+	GetDoFunc = func(req *http.Request) (*http.Response, error) {
+		mu.Lock()
+		ranges = append(ranges, req.Header.Get("Range"))
+		mu.Unlock()
+
+		return &http.Response{
+			StatusCode:    200,
+			Body:          ioutil.NopCloser(strings.NewReader("abcdefghijkl")),
+			ContentLength: 12,
+		}, nil
+	}
+
+	s := NewSplitter(
+		context.Background(),
+		&PathInfo{Source: &Source{Path: testURL, Size: 12}, Dest: f},
+		3,
+		&mockClient{},
+	)
+
+	// Chunks that were not started when the first one was rejected are not
+	// requested before the single stream.
+	assert.NoError(t, s.Download())
+	assert.True(t, len(ranges) >= 2 && len(ranges) <= 4, "%d requests", len(ranges))
+	assert.Equal(t, "bytes=0-11", ranges[len(ranges)-1])
+
+	content, _ := ioutil.ReadFile(f.Name())
+	assert.Equal(t, "abcdefghijkl", string(content))
+}
+
+func TestSplitterErrorStatus(t *testing.T) {
+	dir, f := initTmpStorage()
+	defer os.RemoveAll(dir)
+
+	testURL, _ := url.ParseRequestURI("http://source.com/file.txt")
+	GetDoFunc = func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: 404,
+			Status:     "404 Not Found",
+			Body:       ioutil.NopCloser(strings.NewReader("not found")),
+		}, nil
+	}
+
+	s := NewSplitter(
+		context.Background(),
+		&PathInfo{Source: &Source{Path: testURL, Size: 12}, Dest: f},
+		1,
+		&mockClient{},
+	)
+
+	var re *ResponseError
+	assert.True(t, errors.As(s.Download(), &re))
+	assert.Equal(t, 404, re.StatusCode)
+
+	content, _ := ioutil.ReadFile(f.Name())
+	assert.Empty(t, content)
+}
+
+func TestSplitterSourceChanged(t *testing.T) {
+	dir, f := initTmpStorage()
+	defer os.RemoveAll(dir)
+
+	testURL, _ := url.ParseRequestURI("http://source.com/file.txt")
+	respond := rangeResponder("abcdef")
+
+	var ifRange string
+	GetDoFunc = func(req *http.Request) (*http.Response, error) {
+		ifRange = req.Header.Get("If-Range")
+
+		resp, err := respond(req)
+		resp.Header.Set("ETag", `"v2"`)
+
+		return resp, err
+	}
+
+	s := NewSplitter(
+		context.Background(),
+		&PathInfo{Source: &Source{Path: testURL, Size: 6, ETag: `"v1"`}, Dest: f},
+		1,
+		&mockClient{},
+	)
+
+	err := s.Download()
+	assert.True(t, errors.Is(err, ErrSourceChanged))
+	assert.EqualError(t, err, "splitter: response to bytes=0-5: source changed")
+	assert.Equal(t, `"v1"`, ifRange)
+}
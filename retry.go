@@ -0,0 +1,115 @@
+package splitter
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// A RetryPolicy describes how a failed chunk download is retried. A retried
+// chunk continues from the last byte written to the destination, so only the
+// missing tail of its DownloadRange is requested again.
+//
+// Attempts that managed to write at least one byte reset the attempt counter,
+// hence MaxAttempts limits the number of consecutive attempts without progress.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts per chunk including the
+	// first one. Values less than 2 disable retries.
+	MaxAttempts int
+
+	// BaseDelay is the delay before the first retry. Every next retry doubles
+	// the delay up to MaxDelay. A random jitter of up to half of the delay is
+	// subtracted to avoid retrying all chunks at the same moment.
+	BaseDelay time.Duration
+
+	// MaxDelay caps the delay between attempts. Zero means no cap.
+	MaxDelay time.Duration
+
+	// Retryable reports whether the chunk download error is worth retrying.
+	// DefaultRetryable is used if it is nil.
+	Retryable func(err error) bool
+}
+
+// NewRetryPolicy creates new RetryPolicy instance with DefaultRetryable error
+// classifier.
+func NewRetryPolicy(maxAttempts int, baseDelay, maxDelay time.Duration) *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts: maxAttempts,
+		BaseDelay:   baseDelay,
+		MaxDelay:    maxDelay,
+		Retryable:   DefaultRetryable,
+	}
+}
+
+// DefaultRetryable reports whether err is a transient network error or a
+// temporary server failure. Canceled or expired contexts, local I/O errors and
+// responses that do not match the request are never retried.
+func DefaultRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) ||
+		errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var re *ResponseError
+	if errors.As(err, &re) {
+		return re.Temporary()
+	}
+
+	var ne net.Error
+	var ue *url.Error
+
+	return errors.As(err, &ne) ||
+		errors.As(err, &ue) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE)
+}
+
+// shouldRetry checks whether one more attempt is allowed after err.
+func (rp *RetryPolicy) shouldRetry(attempt int, err error) bool {
+	if rp == nil || attempt >= rp.MaxAttempts {
+		return false
+	}
+
+	if rp.Retryable == nil {
+		return DefaultRetryable(err)
+	}
+
+	return rp.Retryable(err)
+}
+
+// delay returns the jittered backoff delay before the next attempt.
+func (rp *RetryPolicy) delay(attempt int) time.Duration {
+	d := rp.BaseDelay
+	for i := 1; i < attempt && (rp.MaxDelay == 0 || d < rp.MaxDelay); i++ {
+		d *= 2
+	}
+
+	if rp.MaxDelay > 0 && d > rp.MaxDelay {
+		d = rp.MaxDelay
+	}
+
+	if half := int64(d / 2); half > 0 {
+		d -= time.Duration(rand.Int63n(half))
+	}
+
+	return d
+}
+
+// wait sleeps for the backoff delay or until the context is done.
+func (rp *RetryPolicy) wait(ctx context.Context, attempt int) error {
+	t := time.NewTimer(rp.delay(attempt))
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
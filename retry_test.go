@@ -0,0 +1,106 @@
+package splitter
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	rp := NewRetryPolicy(5, 100*time.Millisecond, 300*time.Millisecond)
+
+	delayTests := []struct {
+		attempt  int
+		min, max time.Duration
+	}{
+		{1, 50 * time.Millisecond, 100 * time.Millisecond},
+		{2, 100 * time.Millisecond, 200 * time.Millisecond},
+		{3, 150 * time.Millisecond, 300 * time.Millisecond},
+		{10, 150 * time.Millisecond, 300 * time.Millisecond},
+	}
+
+	for _, dt := range delayTests {
+		d := rp.delay(dt.attempt)
+		assert.True(t, d > dt.min && d <= dt.max, "attempt %d: %v", dt.attempt, d)
+	}
+}
+
+func TestRetryPolicyShouldRetry(t *testing.T) {
+	rp := NewRetryPolicy(2, 0, 0)
+
+	assert.True(t, rp.shouldRetry(1, io.ErrUnexpectedEOF))
+	assert.False(t, rp.shouldRetry(2, io.ErrUnexpectedEOF))
+	assert.False(t, rp.shouldRetry(1, context.Canceled))
+	assert.False(t, rp.shouldRetry(1, &os.PathError{Op: "write", Err: io.ErrShortWrite}))
+
+	var nilPolicy *RetryPolicy
+	assert.False(t, nilPolicy.shouldRetry(1, io.ErrUnexpectedEOF))
+}
+
+func TestSplitterRetryContinuesChunk(t *testing.T) {
+	dir, f := initTmpStorage()
+	defer os.RemoveAll(dir)
+
+	testURL, _ := url.ParseRequestURI("http://source.com/file.txt")
+	bodies := []string{"ab", "cd", "ef"}
+
+	var ranges []string
+	GetDoFunc = func(req *http.Request) (*http.Response, error) {
+		ranges = append(ranges, req.Header.Get("Range"))
+		body := bodies[0]
+		bodies = bodies[1:]
+
+		// The connection drops after two bytes of every response.
+		resp, err := rangeResponder("abcdef")(req)
+		resp.Body = ioutil.NopCloser(strings.NewReader(body))
+		resp.ContentLength = -1
+
+		return resp, err
+	}
+
+	s := NewSplitter(
+		context.Background(),
+		&PathInfo{Source: &Source{Path: testURL, Size: 6}, Dest: f},
+		1,
+		&mockClient{},
+	)
+	s.Retry = NewRetryPolicy(2, time.Millisecond, time.Millisecond)
+
+	assert.NoError(t, s.Download())
+	assert.Equal(t, []string{"bytes=0-5", "bytes=2-5", "bytes=4-5"}, ranges)
+
+	content, _ := ioutil.ReadFile(f.Name())
+	assert.Equal(t, "abcdef", string(content))
+}
+
+func TestSplitterRetryGivesUp(t *testing.T) {
+	dir, f := initTmpStorage()
+	defer os.RemoveAll(dir)
+
+	testURL, _ := url.ParseRequestURI("http://source.com/file.txt")
+
+	attempts := 0
+	GetDoFunc = func(req *http.Request) (*http.Response, error) {
+		attempts++
+		return nil, &url.Error{Op: "Get", URL: testURL.String(), Err: errors.New("timeout")}
+	}
+
+	s := NewSplitter(
+		context.Background(),
+		&PathInfo{Source: &Source{Path: testURL, Size: 6}, Dest: f},
+		1,
+		&mockClient{},
+	)
+	s.Retry = NewRetryPolicy(3, time.Millisecond, time.Millisecond)
+
+	assert.Error(t, s.Download())
+	assert.Equal(t, 3, attempts)
+}
@@ -0,0 +1,74 @@
+package splitter
+
+import (
+	"sync"
+)
+
+// DefaultMinSplitSize is the smallest part of a chunk an idle worker takes
+// over when Splitter.MinSplitSize is not set.
+const DefaultMinSplitSize = 1 << 20
+
+// A scheduler hands out chunks to workers. Queued chunks are handed out first.
+// Once the queue is empty an idle worker takes over the second half of the
+// largest chunk still in flight, so a single slow connection does not dictate
+// the total download time.
+type scheduler struct {
+	journal  *journal
+	minSplit int
+
+	mu       sync.Mutex
+	queue    []*chunk
+	inFlight []*chunk
+	failed   bool
+}
+
+// newScheduler creates new scheduler instance for the queued chunks.
+func newScheduler(j *journal, queue []*chunk, minSplit int) *scheduler {
+	return &scheduler{journal: j, minSplit: minSplit, queue: queue}
+}
+
+// next returns the chunk the worker should download next or nil if there is
+// nothing left to take or a chunk failed.
+func (sc *scheduler) next() *chunk {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	if sc.failed {
+		return nil
+	}
+
+	var c *chunk
+
+	if len(sc.queue) > 0 {
+		c, sc.queue = sc.queue[0], sc.queue[1:]
+	} else {
+		c = sc.journal.split(sc.inFlight, sc.minSplit)
+	}
+
+	if c != nil {
+		sc.inFlight = append(sc.inFlight, c)
+	}
+
+	return c
+}
+
+// fail stops handing out chunks, the download fails with the first error.
+func (sc *scheduler) fail() {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	sc.failed = true
+}
+
+// release marks the chunk as no longer in flight.
+func (sc *scheduler) release(c *chunk) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	for i, f := range sc.inFlight {
+		if f == c {
+			sc.inFlight = append(sc.inFlight[:i], sc.inFlight[i+1:]...)
+			return
+		}
+	}
+}
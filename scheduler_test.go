@@ -0,0 +1,146 @@
+package splitter
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSchedulerNext(t *testing.T) {
+	j := &journal{Chunks: []*chunk{
+		{Start: 0, End: 10},
+		{Start: 10, End: 30, Written: 4},
+	}}
+	sc := newScheduler(j, j.pending(), 2)
+
+	assert.Equal(t, &chunk{Start: 0, End: 10}, sc.next())
+	assert.Equal(t, &chunk{Start: 10, End: 30, Written: 4}, sc.next())
+
+	// The queue is empty, the second half of the largest chunk is taken over.
+	assert.Equal(t, &chunk{Start: 22, End: 30}, sc.next())
+	assert.Equal(t, &chunk{Start: 10, End: 22, Written: 4}, j.Chunks[1])
+	assert.Len(t, j.Chunks, 3)
+
+	sc.release(j.Chunks[1])
+	sc.release(j.Chunks[2])
+	assert.Equal(t, &chunk{Start: 5, End: 10}, sc.next())
+	assert.Equal(t, &chunk{Start: 0, End: 5}, j.Chunks[0])
+}
+
+func TestSchedulerNextMinSplit(t *testing.T) {
+	j := &journal{Chunks: []*chunk{{Start: 0, End: 10, Written: 3}}}
+	sc := newScheduler(j, j.pending(), 4)
+
+	assert.NotNil(t, sc.next())
+	assert.Nil(t, sc.next())
+}
+
+func TestSchedulerFail(t *testing.T) {
+	j := &journal{Chunks: []*chunk{{Start: 0, End: 10}, {Start: 10, End: 20}}}
+	sc := newScheduler(j, j.pending(), 2)
+
+	assert.NotNil(t, sc.next())
+	sc.fail()
+	assert.Nil(t, sc.next())
+}
+
+func TestSplitterChunkFailure(t *testing.T) {
+	dir, f := initTmpStorage()
+	defer os.RemoveAll(dir)
+
+	testURL, _ := url.ParseRequestURI("http://source.com/file.txt")
+	respond := rangeResponder(strings.Repeat("a", 100))
+
+	var mu sync.Mutex
+	var requests int
+	GetDoFunc = func(req *http.Request) (*http.Response, error) {
+		mu.Lock()
+		requests++
+		first := requests == 1
+		mu.Unlock()
+
+		if first {
+			return &http.Response{
+				StatusCode: http.StatusNotFound,
+				Status:     http.StatusText(http.StatusNotFound),
+				Body:       ioutil.NopCloser(strings.NewReader("")),
+			}, nil
+		}
+
+		resp, err := respond(req)
+		if err == nil {
+			resp.Body = ioutil.NopCloser(&slowReader{resp.Body, time.Millisecond})
+		}
+
+		return resp, err
+	}
+
+	s := NewSplitter(
+		context.Background(),
+		&PathInfo{Source: &Source{Path: testURL, Size: 100}, Dest: f},
+		100,
+		&mockClient{},
+	)
+	s.Workers = 2
+
+	assert.Error(t, s.Download())
+	assert.True(t, requests < 10, "%d requests after the first chunk failed", requests)
+}
+
+func TestSplitterWorkStealing(t *testing.T) {
+	dir, f := initTmpStorage()
+	defer os.RemoveAll(dir)
+
+	testURL, _ := url.ParseRequestURI("http://source.com/file.txt")
+	respond := rangeResponder("abcdefghijkl")
+
+	var mu sync.Mutex
+	var ranges []string
+	GetDoFunc = func(req *http.Request) (*http.Response, error) {
+		mu.Lock()
+		ranges = append(ranges, req.Header.Get("Range"))
+		mu.Unlock()
+
+		resp, err := respond(req)
+		if err == nil {
+			resp.Body = ioutil.NopCloser(&slowReader{resp.Body, time.Millisecond})
+		}
+
+		return resp, err
+	}
+
+	s := NewSplitter(
+		context.Background(),
+		&PathInfo{Source: &Source{Path: testURL, Size: 12}, Dest: f},
+		1,
+		&mockClient{},
+	)
+	s.Workers = 2
+	s.MinSplitSize = 3
+
+	assert.NoError(t, s.Download())
+	assert.ElementsMatch(t, []string{"bytes=0-11", "bytes=6-11"}, ranges)
+
+	content, _ := ioutil.ReadFile(f.Name())
+	assert.Equal(t, "abcdefghijkl", string(content))
+}
+
+// slowReader reads a single byte at a time with a delay before each read.
+type slowReader struct {
+	r     io.Reader
+	delay time.Duration
+}
+
+func (sr *slowReader) Read(p []byte) (int, error) {
+	time.Sleep(sr.delay)
+
+	return sr.r.Read(p[:1])
+}
@@ -1,9 +1,12 @@
 package splitter
 
 import (
+	"context"
 	"fmt"
-	"mime"
+	"net/http"
 	"net/url"
+	"strings"
+	"sync"
 )
 
 // SourceError represent error message and context for target source.
@@ -20,49 +23,119 @@ func (pr *SourceError) Error() string {
 // used to split request properly. Retrieving source attributes requires
 // additional request.
 type Source struct {
-	Path   *url.URL
-	Size   int
-	Ext    string
+	Path *url.URL
+	Size int
+	Ext  string
+
+	// FileName is the sanitized file name suggested by the server in the
+	// Content-Disposition header. It is empty if the server suggested none.
+	FileName string
+
+	// AcceptRanges reports whether the server advertised byte range support
+	// or answered the probe with partial content.
+	AcceptRanges bool
+
+	// ETag and LastModified are the validators of the probed representation.
+	ETag         string
+	LastModified string
+
+	// FinalURL is the URL the probe ended up at after following redirects.
+	// Chunks are requested from it, so they do not replay the redirects. It
+	// must not be changed while the source is downloaded, see
+	// Splitter.RefreshURL.
+	FinalURL *url.URL
+
+	// Digests are the checksums of the source advertised by the server.
+	Digests []Checksum
+
+	// Backend fetches the source. The source is fetched over HTTP if it is
+	// nil.
+	Backend RangeSource
+
+	// Request customizes the probe and all chunk requests of HTTP sources.
+	Request *RequestOptions
+
 	client HTTPClient
 }
 
-// NewSource creates new Source instance.
+// finalURLMu guards FinalURL of sources that are downloaded. It is shared by
+// all sources, so Source can still be copied, and URLs are rarely refreshed.
+var finalURLMu sync.RWMutex
+
+// NewSource creates new Source instance fetched over HTTP with the client.
 func NewSource(source *url.URL, client HTTPClient) (*Source, error) {
 	var err error
 
 	s := &Source{Path: source, client: client}
-	err = s.enrichSourceInfo()
+	err = s.enrichSourceInfo(context.Background())
+
+	return s, err
+}
+
+// NewBackendSource creates new Source instance fetched with the RangeSource.
+func NewBackendSource(source *url.URL, rs RangeSource) (*Source, error) {
+	s := &Source{Path: source, Backend: rs}
+	err := s.enrichSourceInfo(context.Background())
 
 	return s, err
 }
 
-// enrichSourceInfo retrieves all necessary source attributes with GET http
-// request. Specifically it tries to fetch source size, content type,
-// extension and fills up Source struct .If at least one of this attributes is
-// unavailable then error will be returned.
-func (s *Source) enrichSourceInfo() error {
-	headResponse, err := s.client.Get(s.Path.String())
-	if err != nil {
-		return &SourceError{
-			context: "cannot fetch source info",
-			err:     err,
-		}
+// enrichSourceInfo retrieves all necessary source attributes with the Backend
+// probe.
+func (s *Source) enrichSourceInfo(ctx context.Context) error {
+	return s.backend(s.client).Probe(ctx, s)
+}
+
+// backend returns the Backend or the HTTP backend with the client and the
+// request options if it is not set.
+func (s *Source) backend(client HTTPClient) RangeSource {
+	if s.Backend != nil {
+		return s.Backend
 	}
 
-	s.Size = int(headResponse.ContentLength)
-	if s.Size == 0 {
-		return &SourceError{context: "cannot fetch content length"}
+	return &HTTPSource{Client: s.Request.forHost(s.Path.Host).client(client)}
+}
+
+// chunkURL returns the URL of chunk requests: FinalURL or Path if the source
+// was not probed.
+func (s *Source) chunkURL() *url.URL {
+	finalURLMu.RLock()
+	defer finalURLMu.RUnlock()
+
+	if s.FinalURL != nil {
+		return s.FinalURL
 	}
 
-	ct, err := mime.ExtensionsByType(headResponse.Header.Get("Content-Type"))
-	if len(ct) == 0 || err != nil {
-		return &SourceError{
-			context: "cannot fetch content type",
-			err:     err,
-		}
+	return s.Path
+}
+
+// setFinalURL replaces FinalURL while chunks are requested from it.
+func (s *Source) setFinalURL(u *url.URL) {
+	finalURLMu.Lock()
+	defer finalURLMu.Unlock()
+
+	s.FinalURL = u
+}
+
+// Validator returns the value for the If-Range header: the ETag of the source
+// if it is a strong one, the Last-Modified date otherwise. It is empty if the
+// server reported neither.
+func (s *Source) Validator() string {
+	if s.ETag != "" && !strings.HasPrefix(s.ETag, "W/") {
+		return s.ETag
 	}
 
-	s.Ext = ct[0]
+	return s.LastModified
+}
+
+// changedSince reports whether the response comes from another version of the
+// source than the probed one. Missing validators are not considered a change.
+func (s *Source) changedSince(h http.Header) bool {
+	return validatorChanged(s.ETag, h.Get("ETag")) ||
+		validatorChanged(s.LastModified, h.Get("Last-Modified"))
+}
 
-	return nil
+// validatorChanged reports whether both validators are known and differ.
+func validatorChanged(old, current string) bool {
+	return old != "" && current != "" && old != current
 }
@@ -4,21 +4,29 @@ import (
 	"errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strings"
 	"testing"
 )
 
 var (
-	GetDoFunc  func(req *http.Request) (*http.Response, error)
-	GetGetFunc func(url string) (resp *http.Response, err error)
+	GetDoFunc   func(req *http.Request) (*http.Response, error)
+	GetGetFunc  func(url string) (resp *http.Response, err error)
+	GetHeadFunc func(url string) (resp *http.Response, err error)
 )
 
 type mockClient struct {
 	mock.Mock
 }
 
+// Do answers HEAD requests with GetHeadFunc and other requests with GetDoFunc.
 func (m *mockClient) Do(req *http.Request) (*http.Response, error) {
+	if req.Method == http.MethodHead {
+		return GetHeadFunc(req.URL.String())
+	}
+
 	return GetDoFunc(req)
 }
 
@@ -30,7 +38,7 @@ func TestNewSource(t *testing.T) {
 	httpClient := &mockClient{}
 	testUrl, _ := url.Parse("http://test-url.com/image/source.jpg")
 
-	GetGetFunc = func(url string) (resp *http.Response, err error) {
+	GetHeadFunc = func(url string) (resp *http.Response, err error) {
 		return &http.Response{
 			StatusCode:    200,
 			Header:        http.Header{"Content-Type": []string{"image/jpeg"}},
@@ -50,7 +58,10 @@ func TestNewSourceRequestError(t *testing.T) {
 	httpClient := &mockClient{}
 	testUrl, _ := url.Parse("http://test-url.com/image/source.jpg")
 
-	GetGetFunc = func(url string) (*http.Response, error) {
+	GetHeadFunc = func(url string) (*http.Response, error) {
+		return nil, errors.New("request failed")
+	}
+	GetDoFunc = func(req *http.Request) (*http.Response, error) {
 		return nil, errors.New("request failed")
 	}
 
@@ -67,12 +78,15 @@ func TestNewSourceContentLengthError(t *testing.T) {
 	httpClient := &mockClient{}
 	testUrl, _ := url.Parse("http://test-url.com/image/source.jpg")
 
-	GetGetFunc = func(url string) (*http.Response, error) {
+	GetHeadFunc = func(url string) (*http.Response, error) {
 		return &http.Response{
 			StatusCode: 200,
 			Header:     http.Header{"Content-Type": []string{"image/jpeg"}},
 		}, nil
 	}
+	GetDoFunc = func(req *http.Request) (*http.Response, error) {
+		return GetHeadFunc(req.URL.String())
+	}
 
 	_, err := NewSource(testUrl, httpClient)
 
@@ -87,7 +101,7 @@ func TestNewSourceContentTypeError(t *testing.T) {
 	httpClient := &mockClient{}
 	testUrl, _ := url.Parse("http://test-url.com/image/source.jpg")
 
-	GetGetFunc = func(url string) (*http.Response, error) {
+	GetHeadFunc = func(url string) (*http.Response, error) {
 		return &http.Response{
 			StatusCode:    200,
 			ContentLength: 100,
@@ -102,3 +116,90 @@ func TestNewSourceContentTypeError(t *testing.T) {
 		"splitter: source: cannot fetch content type: mime: no media type",
 	)
 }
+
+func TestNewSourceHeadMetadata(t *testing.T) {
+	testUrl, _ := url.Parse("http://test-url.com/latest/source.txt")
+	finalUrl, _ := url.Parse("http://cdn.test-url.com/v2/source.txt")
+
+	GetHeadFunc = func(url string) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: 200,
+			Header: http.Header{
+				"Content-Type":  {"text/plain"},
+				"Accept-Ranges": {"bytes"},
+				"Etag":          {`"v2"`},
+				"Last-Modified": {"Wed, 21 Oct 2015 07:28:00 GMT"},
+			},
+			ContentLength: 100,
+			Request:       &http.Request{URL: finalUrl},
+		}, nil
+	}
+
+	s, err := NewSource(testUrl, &mockClient{})
+
+	assert.NoError(t, err)
+	assert.True(t, s.AcceptRanges)
+	assert.Equal(t, `"v2"`, s.ETag)
+	assert.Equal(t, "Wed, 21 Oct 2015 07:28:00 GMT", s.LastModified)
+	assert.Equal(t, finalUrl, s.FinalURL)
+}
+
+func TestNewSourceRangeProbe(t *testing.T) {
+	testUrl, _ := url.Parse("http://test-url.com/image/source.jpg")
+
+	GetHeadFunc = func(url string) (*http.Response, error) {
+		return &http.Response{StatusCode: 405, ContentLength: -1}, nil
+	}
+
+	var probeRange string
+	GetDoFunc = func(req *http.Request) (*http.Response, error) {
+		probeRange = req.Header.Get("Range")
+
+		return &http.Response{
+			StatusCode: 206,
+			Header: http.Header{
+				"Content-Type":  {"text/plain"},
+				"Content-Range": {"bytes 0-0/1234"},
+				"Etag":          {`"abc"`},
+			},
+			Body:          ioutil.NopCloser(strings.NewReader("a")),
+			ContentLength: 1,
+		}, nil
+	}
+
+	s, err := NewSource(testUrl, &mockClient{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "bytes=0-0", probeRange)
+	assert.Equal(t, 1234, s.Size)
+	assert.True(t, s.AcceptRanges)
+	assert.Equal(t, `"abc"`, s.ETag)
+	assert.Equal(t, testUrl, s.FinalURL)
+}
+
+func TestNewSourceStatusError(t *testing.T) {
+	testUrl, _ := url.Parse("http://test-url.com/image/source.jpg")
+
+	GetHeadFunc = func(url string) (*http.Response, error) {
+		return &http.Response{StatusCode: 404, Status: "404 Not Found"}, nil
+	}
+	GetDoFunc = func(req *http.Request) (*http.Response, error) {
+		return GetHeadFunc(req.URL.String())
+	}
+
+	_, err := NewSource(testUrl, &mockClient{})
+
+	assert.EqualError(
+		t,
+		err,
+		"splitter: source: cannot fetch source info: unexpected status 404 Not Found",
+	)
+}
+
+func TestSourceValidator(t *testing.T) {
+	lm := "Wed, 21 Oct 2015 07:28:00 GMT"
+
+	assert.Equal(t, `"v1"`, (&Source{ETag: `"v1"`, LastModified: lm}).Validator())
+	assert.Equal(t, lm, (&Source{ETag: `W/"v1"`, LastModified: lm}).Validator())
+	assert.Equal(t, "", (&Source{ETag: `W/"v1"`}).Validator())
+}
@@ -0,0 +1,58 @@
+package splitter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// InsufficientSpaceError is returned by Download when the filesystem of the
+// destination has not enough free space for the source.
+type InsufficientSpaceError struct {
+	Path      string
+	Required  int64
+	Available int64
+}
+
+func (ie *InsufficientSpaceError) Error() string {
+	return fmt.Sprintf(
+		"splitter: insufficient space for %s: %d bytes required, %d available",
+		ie.Path,
+		ie.Required,
+		ie.Available,
+	)
+}
+
+// checkFreeSpace makes sure the filesystem of the file has at least size bytes
+// available. The check is skipped on platforms where free space is unknown.
+func checkFreeSpace(f *os.File, size int64) error {
+	available, err := freeSpace(filepath.Dir(f.Name()))
+	if err != nil {
+		return &splitterError{context: "cannot fetch free space", err: err}
+	}
+
+	if available >= 0 && available < size {
+		return &InsufficientSpaceError{
+			Path:      f.Name(),
+			Required:  size,
+			Available: available,
+		}
+	}
+
+	return nil
+}
+
+// preallocate reserves size bytes for the file. Platforms without native
+// preallocation extend the file with Truncate, which may leave it sparse.
+func preallocate(f *os.File, size int64) error {
+	if err := allocate(f, size); err != nil {
+		return &splitterError{context: "cannot preallocate destination", err: err}
+	}
+
+	return nil
+}
+
+// truncateAllocate is the portable allocate fallback.
+func truncateAllocate(f *os.File, size int64) error {
+	return f.Truncate(size)
+}
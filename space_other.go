@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !freebsd && !windows
+// +build !linux,!darwin,!freebsd,!windows
+
+package splitter
+
+// freeSpace reports unknown free space.
+func freeSpace(dir string) (int64, error) {
+	return -1, nil
+}
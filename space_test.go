@@ -0,0 +1,67 @@
+package splitter
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/url"
+	"os"
+	"testing"
+)
+
+func TestPreallocate(t *testing.T) {
+	dir, f := initTmpStorage()
+	defer os.RemoveAll(dir)
+
+	assert.NoError(t, preallocate(f, 4096))
+
+	fi, err := f.Stat()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4096), fi.Size())
+}
+
+func TestCheckFreeSpace(t *testing.T) {
+	dir, f := initTmpStorage()
+	defer os.RemoveAll(dir)
+
+	assert.NoError(t, checkFreeSpace(f, 1))
+
+	available, _ := freeSpace(dir)
+	if available < 0 {
+		t.Skip("free space is unknown on this platform")
+	}
+
+	err := checkFreeSpace(f, available+1<<40)
+
+	var ie *InsufficientSpaceError
+	assert.True(t, errors.As(err, &ie))
+	assert.Equal(t, f.Name(), ie.Path)
+	assert.Equal(t, available, ie.Available)
+}
+
+func TestSplitterCheckSpace(t *testing.T) {
+	dir, f := initTmpStorage()
+	defer os.RemoveAll(dir)
+
+	if available, _ := freeSpace(dir); available < 0 {
+		t.Skip("free space is unknown on this platform")
+	}
+
+	testURL, _ := url.ParseRequestURI("http://source.com/file.txt")
+	GetDoFunc = func(req *http.Request) (*http.Response, error) {
+		t.Error("unexpected chunk request")
+		return nil, errors.New("unexpected chunk request")
+	}
+
+	s := NewSplitter(
+		context.Background(),
+		&PathInfo{Source: &Source{Path: testURL, Size: 1 << 62}, Dest: f},
+		2,
+		&mockClient{},
+	)
+	s.Preallocate = true
+
+	var ie *InsufficientSpaceError
+	assert.True(t, errors.As(s.Download(), &ie))
+}
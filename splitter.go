@@ -3,7 +3,10 @@
 //
 // The splitter package can handle only URL (RFC 3986) as source and save
 // destination and file or directory. It won't create any new directory but
-// file name only in case it was not provided.
+// file name only in case it was not provided. HTTP, FTP and local files are
+// supported out of the box, other protocols can be plugged in as a
+// RangeSource. Other storage, e.g. memory, can be used as a Destination of
+// Splitter.
 //
 // The number of chunks into which the file will be split is determined when
 // the splitter instance is initialized.
@@ -11,18 +14,122 @@ package splitter
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"golang.org/x/sync/errgroup"
 	"io"
 	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
 )
 
+// PartSuffix is appended to the destination file name to build the path of the
+// temporary file used by Splitter.Atomic.
+const PartSuffix = ".part"
+
 // Splitter allows to download source file by chunks asynchronously.
 type Splitter struct {
 	Ctx      context.Context
 	PI       *PathInfo
 	ChunkCnt int
-	client   HTTPClient
+
+	// Destination receives the downloaded bytes instead of PathInfo.Dest if
+	// it is not nil, e.g. a Buffer or a custom storage backend.
+	Destination Destination
+
+	// Workers limits the number of chunks downloaded at once. Each worker
+	// keeps one connection open and pulls the next chunk from a queue when
+	// its current chunk is done. Zero means one worker per chunk.
+	Workers int
+
+	// MinSplitSize is the smallest number of bytes an idle worker takes over
+	// from a chunk that is still in progress. DefaultMinSplitSize is used if
+	// it is zero.
+	MinSplitSize int
+
+	// Retry is the policy for failed chunks. A failed chunk fails the whole
+	// download if it is nil.
+	Retry *RetryPolicy
+
+	// OnProgress is called with a snapshot of the download every
+	// ProgressInterval and whenever a chunk changes its state. Calls are made
+	// from a single goroutine, the last one after all chunks are finished.
+	OnProgress func(Progress)
+
+	// ProgressInterval is the interval between periodic progress reports.
+	// DefaultProgressInterval is used if it is zero.
+	ProgressInterval time.Duration
+
+	// Checksum is the expected checksum of the source. If it is nil, the
+	// digests advertised by the server are verified unless
+	// IgnoreSourceDigests is set. A mismatch is reported as
+	// VerificationError.
+	Checksum *Checksum
+
+	// IgnoreSourceDigests disables verification of the digests advertised
+	// by the server.
+	IgnoreSourceDigests bool
+
+	// RestartOnChange makes Download and Resume start over once if the
+	// source is modified while it is downloaded or since the journal was
+	// written. Otherwise ErrSourceChanged is returned.
+	RestartOnChange bool
+
+	// Atomic makes Download and Resume write into a temporary file on the
+	// same filesystem as the destination. Only after all chunks are written
+	// and verified the temporary file is synced and renamed over the
+	// destination, so the destination never holds a partial download. An
+	// interrupted download is continued from the temporary file by Resume.
+	// It cannot be used with Destination.
+	Atomic bool
+
+	// TempPath is the temporary file used by Atomic. The destination path
+	// with PartSuffix is used if it is empty.
+	TempPath string
+
+	// Preallocate makes Download reserve the source size on the destination
+	// filesystem before any chunk is requested. It implies CheckSpace.
+	Preallocate bool
+
+	// CheckSpace makes Download fail with InsufficientSpaceError before any
+	// chunk is requested if the destination filesystem is short of space.
+	CheckSpace bool
+
+	// RateLimit caps the aggregate bandwidth of all chunks. It may be shared
+	// with other Splitter instances and adjusted while a download is running.
+	RateLimit *RateLimiter
+
+	// ConnLimit caps the number of connections opened at once. It may be
+	// shared with other Splitter instances, see SetPriority.
+	ConnLimit *ConnLimiter
+
+	// MaxBuffer is the memory ceiling of Stream in bytes. DefaultMaxBuffer
+	// is used if it is zero.
+	MaxBuffer int
+
+	// RefreshURL returns a fresh URL of the source when a chunk request is
+	// rejected with 403 Forbidden or 410 Gone, e.g. because a presigned URL
+	// expired. The remaining ranges are requested from the fresh URL, which
+	// is stored in Source.FinalURL. It is called once for all chunks that
+	// failed with the same URL. If it is nil, an HTTP source that was
+	// redirected is resolved again from Source.Path.
+	RefreshURL func(ctx context.Context, src *Source) (*url.URL, error)
+
+	client    HTTPClient
+	journal   *journal
+	progress  *progressReporter
+	mu        sync.Mutex
+	connLimit int
+	priority  int
+	stream    *orderedWriter
+	refreshMu sync.Mutex
+
+	// singleStream is set once the server turned out to ignore the Range
+	// header. The source is then downloaded with a single sequential request.
+	singleStream bool
 }
 
 type splitterError struct {
@@ -34,6 +141,10 @@ func (se *splitterError) Error() string {
 	return fmt.Sprintf("splitter: %s: %v", se.context, se.err)
 }
 
+func (se *splitterError) Unwrap() error {
+	return se.err
+}
+
 // NewSplitter creates new Splitter instance.
 func NewSplitter(ctx context.Context, pi *PathInfo, chunkCnt int, c HTTPClient) *Splitter {
 	return &Splitter{Ctx: ctx, PI: pi, ChunkCnt: chunkCnt, client: c}
@@ -41,30 +152,188 @@ func NewSplitter(ctx context.Context, pi *PathInfo, chunkCnt int, c HTTPClient)
 
 // Download initialize download process. It checks for content length and
 // creates DownloadRange iterator. Each file's chunk will be downloaded
-// asynchronously.
+// asynchronously. The assembled file is verified against the expected
+// checksum, see Splitter.Checksum.
+//
+// The download state is recorded in a journal next to the destination file
+// (see JournalSuffix) so an interrupted download can be continued with Resume.
+// The journal is removed once all chunks are written.
+//
+// Every chunk request is conditional on the validator of the source, so a
+// source modified during the download fails it with ErrSourceChanged, see
+// Splitter.RestartOnChange.
 func (s *Splitter) Download() error {
-	err := s.PI.Dest.Truncate(0)
+	return s.atomically(func() error {
+		return s.finish(s.download())
+	})
+}
+
+// Resume resumes interrupted download process. It reads the journal left by
+// an interrupted Download and fetches only the byte ranges that were not
+// written to the destination. Each file's chunk will be downloaded
+// asynchronously.
+//
+// If there is no journal the destination is assumed to hold a contiguous
+// prefix of the source, and a new DownloadRange iterator is created based on
+// the current destination size. If the source was modified since the journal
+// was written ErrSourceChanged is returned.
+//
+// Unlike Download it will not override existing content. If you need a clean
+// download use Download method.
+func (s *Splitter) Resume() error {
+	return s.atomically(func() error {
+		return s.finish(s.resume())
+	})
+}
+
+// atomically runs fn with the temporary file as the destination if Atomic is
+// set and renames the temporary file over the destination once fn succeeded.
+// The temporary file is left for Resume if fn fails, while the destination is
+// removed if PathResolver created it, so no empty file is left under its name.
+func (s *Splitter) atomically(fn func() error) error {
+	if !s.Atomic {
+		return fn()
+	}
+
+	if s.Destination != nil {
+		return &splitterError{context: "cannot use temporary file", err: errNoFile}
+	}
+
+	final := s.PI.Dest
+
+	part, err := os.OpenFile(s.tempPath(), os.O_RDWR|os.O_CREATE, 0666)
 	if err != nil {
-		return &splitterError{
-			context: "cannot truncate destination file",
-			err:     err,
+		return &splitterError{context: "cannot open temporary file", err: err}
+	}
+
+	s.PI.Dest = part
+
+	err = fn()
+	if err == nil {
+		err = s.commit(final, part)
+	}
+
+	if err != nil {
+		_ = part.Close()
+		s.PI.Dest = final
+		s.removeCreated()
+
+		return err
+	}
+
+	return nil
+}
+
+// removeCreated removes the destination if PathResolver created it and it is
+// still empty.
+func (s *Splitter) removeCreated() {
+	if !s.PI.created {
+		return
+	}
+
+	if fi, err := s.PI.Dest.Stat(); err == nil && fi.Size() == 0 {
+		_ = os.Remove(s.PI.Dest.Name())
+	}
+}
+
+// commit syncs the temporary file, renames it over the destination and
+// reopens the destination.
+func (s *Splitter) commit(final, part *os.File) error {
+	if err := part.Sync(); err != nil {
+		return &splitterError{context: "cannot sync temporary file", err: err}
+	}
+
+	if err := os.Rename(part.Name(), final.Name()); err != nil {
+		return &splitterError{context: "cannot rename temporary file", err: err}
+	}
+
+	if dir, err := os.Open(filepath.Dir(final.Name())); err == nil {
+		_ = dir.Sync()
+		_ = dir.Close()
+	}
+
+	f, err := os.OpenFile(final.Name(), os.O_RDWR, 0)
+	if err != nil {
+		return &splitterError{context: "cannot reopen destination", err: err}
+	}
+
+	_ = part.Close()
+	_ = final.Close()
+	s.PI.Dest = f
+
+	return nil
+}
+
+// tempPath returns the path of the temporary file used by Atomic.
+func (s *Splitter) tempPath() string {
+	if s.TempPath != "" {
+		return s.TempPath
+	}
+
+	return s.PI.Dest.Name() + PartSuffix
+}
+
+// download truncates the destination and downloads the source from scratch.
+func (s *Splitter) download() error {
+	d := s.dest()
+
+	if t, ok := d.(truncater); ok {
+		if err := t.Truncate(0); err != nil {
+			return &splitterError{
+				context: "cannot truncate destination file",
+				err:     err,
+			}
 		}
 	}
 
-	_, _ = s.PI.Dest.Seek(0, 0)
+	if sk, ok := d.(io.Seeker); ok {
+		_, _ = sk.Seek(0, 0)
+	}
+
+	if err := s.reserveSpace(); err != nil {
+		return err
+	}
+
+	s.journal = newJournal(
+		s.PI.Source,
+		destFile(d),
+		NewRangeBuilder(s.PI.Source.Size, s.ChunkCnt, 0),
+	)
+	if err := s.journal.save(); err != nil {
+		return err
+	}
 
-	return s.process(NewRangeBuilder(s.PI.Source.Size, s.ChunkCnt, 0))
+	return s.run(s.journal.Chunks)
 }
 
-// Resume resumes interrupted download process. It checks for the content length
-// of a source file and destination file respectively. Base on the current
-// destination file new DownloadRange iterator will be created. Each file's
-// chunk will be downloaded asynchronously.
-//
-// Unlike Download it will not override existing content. If you need a clean
-// download use Download method.
-func (s *Splitter) Resume() error {
-	ds, err := s.PI.Dest.Stat()
+// reserveSpace checks free space and preallocates the destination according
+// to the CheckSpace and Preallocate options.
+func (s *Splitter) reserveSpace() error {
+	if !s.CheckSpace && !s.Preallocate {
+		return nil
+	}
+
+	size := int64(s.PI.Source.Size)
+
+	f := destFile(s.dest())
+	if f == nil {
+		return &splitterError{context: "cannot reserve space", err: errNoFile}
+	}
+
+	if err := checkFreeSpace(f, size); err != nil {
+		return err
+	}
+
+	if s.Preallocate {
+		return preallocate(f, size)
+	}
+
+	return nil
+}
+
+// resume downloads the chunks missing according to the journal.
+func (s *Splitter) resume() error {
+	size, err := destSize(s.dest())
 	if err != nil {
 		return &splitterError{
 			context: "cannot fetch destination size",
@@ -72,51 +341,371 @@ func (s *Splitter) Resume() error {
 		}
 	}
 
-	return s.process(
-		NewRangeBuilder(s.PI.Source.Size, s.ChunkCnt, int(ds.Size())),
+	f := destFile(s.dest())
+
+	var j *journal
+	if f != nil {
+		j, err = loadJournal(f)
+	} else {
+		err = os.ErrNotExist
+	}
+
+	switch {
+	case os.IsNotExist(err):
+		j = newJournal(
+			s.PI.Source,
+			f,
+			NewRangeBuilder(s.PI.Source.Size, s.ChunkCnt, int(size)),
+		)
+	case err != nil:
+		return err
+	case !j.matches(s.PI.Source):
+		return &splitterError{
+			context: "cannot resume",
+			err:     fmt.Errorf("journal %s does not match source", j.path),
+		}
+	case j.changed(s.PI.Source):
+		return &splitterError{context: "cannot resume", err: ErrSourceChanged}
+	}
+
+	s.journal = j
+
+	return s.run(j.pending())
+}
+
+// finish handles the result of download or resume. If the source changed and
+// RestartOnChange is set, the source is probed again and downloaded from
+// scratch once. A complete download is verified.
+func (s *Splitter) finish(err error) error {
+	if errors.Is(err, ErrSourceChanged) && s.RestartOnChange {
+		_ = s.journal.remove()
+
+		err = s.PI.Source.enrichSourceInfo(s.Ctx)
+		if err == nil {
+			err = s.download()
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if sy, ok := s.dest().(syncer); ok {
+		if err := sy.Sync(); err != nil {
+			return &splitterError{context: "cannot sync destination", err: err}
+		}
+	}
+
+	return s.verify()
+}
+
+// run downloads the chunks. If the server does not support range requests the
+// download restarts as a single sequential stream from the beginning.
+func (s *Splitter) run(chunks []*chunk) error {
+	err := s.process(chunks)
+	if !errors.Is(err, ErrRangeNotSupported) || s.singleStream {
+		return err
+	}
+
+	s.singleStream = true
+	s.journal = newJournal(
+		s.PI.Source,
+		s.journal.dest,
+		NewRangeBuilder(s.PI.Source.Size, 1, 0),
+	)
+
+	return s.process(s.journal.Chunks)
+}
+
+// verify compares the destination content with the expected checksums.
+func (s *Splitter) verify() error {
+	checksums := s.checksums()
+	if len(checksums) == 0 {
+		return nil
+	}
+
+	ra, ok := s.dest().(io.ReaderAt)
+	if !ok {
+		return nil
+	}
+
+	return verifyChecksums(
+		io.NewSectionReader(ra, 0, int64(s.PI.Source.Size)),
+		checksums,
 	)
 }
 
-// process initialize download process.
-func (s *Splitter) process(rb *RangeBuilder) error {
+// checksums returns the checksums the download is verified against.
+func (s *Splitter) checksums() []Checksum {
+	if s.Checksum != nil {
+		return []Checksum{*s.Checksum}
+	}
+
+	if s.IgnoreSourceDigests {
+		return nil
+	}
+
+	return s.PI.Source.Digests
+}
+
+// process initialize download process. Chunks are put into a queue that is
+// drained by at most Workers goroutines. A worker that finds the queue empty
+// splits the largest chunk in flight and downloads its second half. No chunk
+// is started once a chunk failed. The
+// journal is removed when all chunks are downloaded and flushed with the
+// latest progress otherwise.
+func (s *Splitter) process(chunks []*chunk) error {
 	var g errgroup.Group
 
-	for {
-		nRange, err := rb.NextRange()
-		if err == ErrOutOfRange {
-			break
-		}
+	sc := newScheduler(s.journal, chunks, s.minSplitSize())
 
+	if s.OnProgress != nil {
+		s.progress = newProgressReporter(
+			s.OnProgress,
+			s.ProgressInterval,
+			s.journal,
+		)
+		defer s.progress.stop()
+	}
+
+	for i := 0; i < s.workerCount(len(chunks)); i++ {
 		g.Go(func() error {
-			return s.downloadChunk(nRange)
+			for c := sc.next(); c != nil; c = sc.next() {
+				s.setChunkState(c, ChunkRunning)
+				err := s.fetchChunk(c)
+				sc.release(c)
+
+				if err != nil {
+					sc.fail()
+					return err
+				}
+			}
+
+			return nil
 		})
 	}
 
-	err := g.Wait()
+	if err := g.Wait(); err != nil {
+		_ = s.journal.save()
+		return err
+	}
+
+	return s.journal.remove()
+}
+
+// SetConnRateLimit caps the bandwidth of every single connection in bytes per
+// second. Zero disables the limit. It may be called while a download is
+// running.
+func (s *Splitter) SetConnRateLimit(bytesPerSec int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	return err
+	s.connLimit = bytesPerSec
 }
 
-// downloadChunk creates and performs a new request for file chunk. The new
-// request will fetch file's bytes range based on DownloadRange. After a
-// successful response result will be written to dest path with an offset from
-// DownloadRange.
-func (s *Splitter) downloadChunk(dr DownloadRange) error {
-	r, err := s.newChunkRequest(dr)
+// SetPriority sets the priority of the chunks waiting for a connection of
+// ConnLimit. Chunks of Splitter instances with higher priority are served
+// first. It may be called while a download is running.
+func (s *Splitter) SetPriority(priority int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.priority = priority
+}
+
+// connPriority returns the current priority.
+func (s *Splitter) connPriority() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.priority
+}
+
+// connRateLimit returns the current per-connection limit.
+func (s *Splitter) connRateLimit() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.connLimit
+}
+
+// workerCount returns the number of workers for n queued chunks.
+func (s *Splitter) workerCount(n int) int {
+	if s.singleStream {
+		return 1
+	}
+
+	if s.Workers > 0 {
+		return s.Workers
+	}
+
+	if s.stream != nil {
+		return s.ChunkCnt
+	}
+
+	return n
+}
+
+// minSplitSize returns the smallest part of a chunk that can be taken over or
+// -1 if chunks must not be split.
+func (s *Splitter) minSplitSize() int {
+	if s.singleStream {
+		return -1
+	}
+
+	if s.MinSplitSize > 0 {
+		return s.MinSplitSize
+	}
+
+	return DefaultMinSplitSize
+}
+
+// setChunkState records the chunk state transition and notifies the progress
+// reporter.
+func (s *Splitter) setChunkState(c *chunk, state ChunkState) {
+	if s.journal != nil {
+		s.journal.setState(c, state)
+	}
+
+	s.progress.changed()
+}
+
+// fetchChunk downloads the chunk and retries it according to the retry policy.
+// Every attempt continues from the last written byte of the chunk.
+//
+// A chunk rejected because its URL expired is continued from a refreshed URL
+// without counting an attempt, once until the chunk makes progress again.
+func (s *Splitter) fetchChunk(c *chunk) error {
+	refreshed := false
+
+	for attempt := 1; ; attempt++ {
+		written := c.Written
+		u := s.PI.Source.chunkURL()
+
+		err := s.downloadChunk(c)
+		if err == nil {
+			s.setChunkState(c, ChunkDone)
+			return nil
+		}
+
+		if c.Written > written {
+			attempt = 1
+			refreshed = false
+		}
+
+		if !refreshed && urlExpired(err) && s.refresher() != nil {
+			refreshed = true
+
+			if err = s.refreshURL(u); err == nil {
+				attempt--
+				continue
+			}
+		}
+
+		if !s.Retry.shouldRetry(attempt, err) {
+			return s.failChunk(c, err)
+		}
+
+		s.setChunkState(c, ChunkRetrying)
+		if err := s.Retry.wait(s.Ctx, attempt); err != nil {
+			return s.failChunk(c, err)
+		}
+		s.setChunkState(c, ChunkRunning)
+	}
+}
+
+// urlExpired reports whether the chunk request was rejected in a way an
+// expired signed URL is.
+func urlExpired(err error) bool {
+	var re *ResponseError
+
+	return errors.As(err, &re) &&
+		(re.StatusCode == http.StatusForbidden || re.StatusCode == http.StatusGone)
+}
+
+// refreshURL replaces the expired URL of chunk requests with a fresh one
+// unless another chunk did it already.
+func (s *Splitter) refreshURL(expired *url.URL) error {
+	s.refreshMu.Lock()
+	defer s.refreshMu.Unlock()
+
+	src := s.PI.Source
+	if src.chunkURL() != expired {
+		return nil
+	}
+
+	u, err := s.refresher()(s.Ctx, src)
 	if err != nil {
+		return &splitterError{context: "cannot refresh source URL", err: err}
+	}
+
+	src.setFinalURL(u)
+
+	return nil
+}
+
+// refresher returns RefreshURL or, for an HTTP source that was redirected,
+// the function that resolves the redirects again. It returns nil if the URL
+// cannot be refreshed.
+func (s *Splitter) refresher() func(ctx context.Context, src *Source) (*url.URL, error) {
+	if s.RefreshURL != nil {
+		return s.RefreshURL
+	}
+
+	// The workers call it while FinalURL is refreshed, so the URL is read
+	// with chunkURL.
+	src := s.PI.Source
+	if src.Backend != nil || src.chunkURL().String() == src.Path.String() {
+		return nil
+	}
+
+	hs, _ := src.backend(s.client).(*HTTPSource)
+
+	return hs.redirect
+}
+
+// failChunk marks the chunk as failed and returns err. In Stream mode the
+// output is stopped, so the workers waiting for the failed chunk are released,
+// unless the download falls back to a single stream.
+func (s *Splitter) failChunk(c *chunk, err error) error {
+	s.setChunkState(c, ChunkFailed)
+
+	if !errors.Is(err, ErrRangeNotSupported) || s.singleStream {
+		s.stream.fail(err)
+	}
+
+	return err
+}
+
+// downloadChunk opens the bytes of the chunk that were not written yet with
+// the source Backend, or with the Splitter client over HTTP if the Backend is
+// not set. The bytes will be written to dest path with an offset from the
+// chunk.
+//
+// In single stream mode the chunk is always downloaded from its start because
+// the server cannot continue from the last written byte.
+func (s *Splitter) downloadChunk(c *chunk) error {
+	if s.singleStream {
+		s.journal.reset(c)
+	}
+
+	dr := s.journal.remaining(c)
+
+	// Chunks are requested from FinalURL, which may be on another host.
+	host := s.PI.Source.chunkURL().Host
+	if err := s.ConnLimit.acquire(s.Ctx, host, s.connPriority()); err != nil {
 		return err
 	}
+	defer s.ConnLimit.release(host)
 
-	response, err := s.client.Do(r)
+	body, err := s.PI.Source.backend(s.client).OpenRange(s.Ctx, s.PI.Source, dr)
 	if err != nil {
-		return &splitterError{
-			context: "chunk download error",
-			err:     err,
-		}
+		return err
 	}
 
-	defer response.Body.Close()
-	_, err = s.writeChunk(response.Body, int64(dr.Start))
+	defer body.Close()
+
+	_, err = s.writeChunk(s.throttle(body), c)
 	if err != nil {
 		return err
 	}
@@ -124,16 +713,25 @@ func (s *Splitter) downloadChunk(dr DownloadRange) error {
 	return nil
 }
 
-// writeChunk writes result bytes range to destination file with specified offset.
-func (s *Splitter) writeChunk(r io.Reader, offset int64) (int, error) {
+// writeChunk writes result bytes range to destination file at the chunk
+// offset and records the progress in the journal. Bytes beyond the chunk end
+// are discarded, hence the chunk may be shortened while it is written. A
+// response that ends before the chunk is complete results in
+// io.ErrUnexpectedEOF.
+func (s *Splitter) writeChunk(r io.Reader, c *chunk) (int, error) {
 	buf := make([]byte, 400)
 	written := 0
 
-	for {
-		m, eof := r.Read(buf[0:cap(buf)])
+	for dr := s.journal.remaining(c); dr.Start < dr.End; dr = s.journal.remaining(c) {
+		n := cap(buf)
+		if dr.End-dr.Start < n {
+			n = dr.End - dr.Start
+		}
+
+		m, rErr := r.Read(buf[0:n])
 
 		if m > 0 {
-			_, err := s.PI.Dest.WriteAt(buf[:m], offset)
+			_, err := s.writer().WriteAt(buf[:m], int64(dr.Start))
 			if err != nil {
 				return 0, &splitterError{
 					context: "error on writing data",
@@ -142,31 +740,52 @@ func (s *Splitter) writeChunk(r io.Reader, offset int64) (int, error) {
 			}
 
 			written += m
-			offset += int64(m)
+
+			if err := s.journal.advance(c, m); err != nil {
+				return written, err
+			}
 		}
 
-		if eof == io.EOF {
-			break
+		if rErr == io.EOF && dr.Start+m < dr.End {
+			rErr = io.ErrUnexpectedEOF
+		}
+
+		if rErr != nil && rErr != io.EOF {
+			return written, &splitterError{
+				context: "error on reading data",
+				err:     rErr,
+			}
 		}
 	}
 
 	return written, nil
 }
 
-// newChunkRequest make new request to target source with provided DownloadRange
-// info. Request will use "Range" header to download specific chunk of source.
-func (s *Splitter) newChunkRequest(dr DownloadRange) (*http.Request, error) {
-	request, err := http.NewRequestWithContext(
-		s.Ctx,
-		"GET",
-		s.PI.Source.Path.String(),
-		nil,
-	)
-	if err != nil {
-		return nil, &splitterError{context: "cannot prepare request", err: err}
+// writer returns the destination of the chunk data.
+func (s *Splitter) writer() io.WriterAt {
+	if s.stream != nil {
+		return s.stream
 	}
 
-	request.Header.Add("Range", dr.BuildRangeHeader())
+	return s.dest()
+}
+
+// dest returns the Destination or PathInfo.Dest if it is not set.
+func (s *Splitter) dest() Destination {
+	if s.Destination != nil {
+		return s.Destination
+	}
 
-	return request, nil
+	return s.PI.Dest
+}
+
+// throttle applies the global and per-connection rate limits to the reader.
+func (s *Splitter) throttle(r io.Reader) io.Reader {
+	return &throttledReader{
+		ctx:       s.Ctx,
+		r:         r,
+		global:    s.RateLimit,
+		conn:      NewRateLimiter(0),
+		connLimit: s.connRateLimit,
+	}
 }
@@ -3,13 +3,17 @@ package splitter
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/stretchr/testify/assert"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestSplitter_Download(t *testing.T) {
@@ -25,7 +29,7 @@ func TestSplitter_Download(t *testing.T) {
 		ContentLength: 6,
 	}
 
-	GetGetFunc = func(url string) (resp *http.Response, err error) {
+	GetHeadFunc = func(url string) (resp *http.Response, err error) {
 		return mockResponse, nil
 	}
 
@@ -60,7 +64,7 @@ func TestSplitterDownloadTruncateError(t *testing.T) {
 		ContentLength: 6,
 	}
 
-	GetGetFunc = func(url string) (resp *http.Response, err error) {
+	GetHeadFunc = func(url string) (resp *http.Response, err error) {
 		return mockResponse, nil
 	}
 
@@ -102,7 +106,7 @@ func TestSplitter_Resume(t *testing.T) {
 		ContentLength: 6,
 	}
 
-	GetGetFunc = func(url string) (resp *http.Response, err error) {
+	GetHeadFunc = func(url string) (resp *http.Response, err error) {
 		return mockResponse, nil
 	}
 
@@ -143,13 +147,11 @@ func TestSplitterResumeFileStatError(t *testing.T) {
 		ContentLength: 6,
 	}
 
-	GetGetFunc = func(url string) (resp *http.Response, err error) {
+	GetHeadFunc = func(url string) (resp *http.Response, err error) {
 		return mockResponse, nil
 	}
 
-	GetDoFunc = func(req *http.Request) (*http.Response, error) {
-		return mockResponse, nil
-	}
+	GetDoFunc = rangeResponder("abcdef")
 
 	pr := PathResolver{
 		Source: "http://test-url.com/test/text",
@@ -168,7 +170,7 @@ func TestSplitterResumeFileStatError(t *testing.T) {
 func TestDownloadChunkError(t *testing.T) {
 	s := splitterStub(nil)
 
-	err := s.downloadChunk(DownloadRange{0, 6})
+	err := s.downloadChunk(&chunk{Start: 0, End: 6})
 	assert.EqualError(
 		t,
 		err,
@@ -183,7 +185,7 @@ func TestDownloadChunkReqError(t *testing.T) {
 
 	s := splitterStub(context.Background())
 
-	err := s.downloadChunk(DownloadRange{0, 6})
+	err := s.downloadChunk(&chunk{Start: 0, End: 6})
 	assert.EqualError(
 		t,
 		err,
@@ -206,7 +208,7 @@ func TestWriteChunkError(t *testing.T) {
 	s := splitterStub(context.Background())
 	s.PI.Dest = nil
 
-	err := s.downloadChunk(DownloadRange{0, 6})
+	err := s.downloadChunk(&chunk{Start: 0, End: 6})
 	assert.EqualError(
 		t,
 		err,
@@ -214,6 +216,165 @@ func TestWriteChunkError(t *testing.T) {
 	)
 }
 
+func TestSplitterWorkers(t *testing.T) {
+	dir, f := initTmpStorage()
+	defer os.RemoveAll(dir)
+
+	testURL, _ := url.ParseRequestURI("http://source.com/file.txt")
+
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	respond := rangeResponder("abcdefghijkl")
+
+	GetDoFunc = func(req *http.Request) (*http.Response, error) {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+
+		return respond(req)
+	}
+
+	s := NewSplitter(
+		context.Background(),
+		&PathInfo{Source: &Source{Path: testURL, Size: 12}, Dest: f},
+		6,
+		&mockClient{},
+	)
+	s.Workers = 2
+
+	assert.NoError(t, s.Download())
+	assert.Equal(t, 2, maxInFlight)
+
+	content, _ := ioutil.ReadFile(f.Name())
+	assert.Equal(t, "abcdefghijkl", string(content))
+}
+
+func TestSplitterAtomic(t *testing.T) {
+	dir, f := initTmpStorage()
+	defer os.RemoveAll(dir)
+
+	testURL, _ := url.ParseRequestURI("http://source.com/file.txt")
+	respond := rangeResponder("abcdef")
+	_, _ = f.WriteString("old")
+
+	fail := true
+	GetDoFunc = func(req *http.Request) (*http.Response, error) {
+		content, _ := ioutil.ReadFile(f.Name())
+		assert.Equal(t, "old", string(content))
+
+		if fail && req.Header.Get("Range") == "bytes=3-5" {
+			return nil, errors.New("connection reset")
+		}
+
+		return respond(req)
+	}
+
+	s := NewSplitter(
+		context.Background(),
+		&PathInfo{Source: &Source{Path: testURL, Size: 6}, Dest: f},
+		2,
+		&mockClient{},
+	)
+	s.Atomic = true
+
+	assert.Error(t, s.Download())
+	assert.Equal(t, f, s.PI.Dest)
+
+	part, _ := ioutil.ReadFile(f.Name() + PartSuffix)
+	assert.Equal(t, "abc", string(part))
+
+	fail = false
+	assert.NoError(t, s.Resume())
+
+	content, _ := ioutil.ReadFile(f.Name())
+	assert.Equal(t, "abcdef", string(content))
+	assert.Equal(t, f.Name(), s.PI.Dest.Name())
+
+	for _, p := range []string{f.Name() + PartSuffix, f.Name() + PartSuffix + JournalSuffix} {
+		_, err := os.Stat(p)
+		assert.True(t, os.IsNotExist(err), p)
+	}
+}
+
+func TestSplitterAtomicCreatedDestination(t *testing.T) {
+	dir, f := initTmpStorage()
+	defer os.RemoveAll(dir)
+	f.Close()
+
+	respond := rangeResponder("abcdef")
+
+	GetHeadFunc = func(url string) (*http.Response, error) {
+		return &http.Response{
+			StatusCode:    200,
+			Header:        http.Header{"Content-Type": {"text/plain"}},
+			ContentLength: 6,
+		}, nil
+	}
+
+	fail := true
+	GetDoFunc = func(req *http.Request) (*http.Response, error) {
+		if fail && req.Header.Get("Range") == "bytes=3-5" {
+			return nil, errors.New("connection reset")
+		}
+
+		return respond(req)
+	}
+
+	pi, err := NewPathResolver("http://source.com/new.txt", dir, &mockClient{}).PathInfo()
+	assert.NoError(t, err)
+
+	dest := filepath.Join(dir, "new.txt")
+	assert.Equal(t, dest, pi.Dest.Name())
+
+	s := NewSplitter(context.Background(), pi, 2, &mockClient{})
+	s.Atomic = true
+
+	assert.Error(t, s.Download())
+
+	_, err = os.Stat(dest)
+	assert.True(t, os.IsNotExist(err))
+
+	part, _ := ioutil.ReadFile(dest + PartSuffix)
+	assert.Equal(t, "abc", string(part))
+
+	fail = false
+	assert.NoError(t, s.Resume())
+
+	content, _ := ioutil.ReadFile(dest)
+	assert.Equal(t, "abcdef", string(content))
+	_ = s.PI.Dest.Close()
+}
+
+// rangeResponder returns a GetDoFunc that serves the requested byte range of
+// content with 206 status.
+func rangeResponder(content string) func(req *http.Request) (*http.Response, error) {
+	return func(req *http.Request) (*http.Response, error) {
+		var start, end int
+		_, err := fmt.Sscanf(req.Header.Get("Range"), "bytes=%d-%d", &start, &end)
+		if err != nil {
+			return nil, err
+		}
+
+		return &http.Response{
+			StatusCode: 206,
+			Header: http.Header{"Content-Range": {
+				fmt.Sprintf("bytes %d-%d/%d", start, end, len(content)),
+			}},
+			Body:          ioutil.NopCloser(strings.NewReader(content[start : end+1])),
+			ContentLength: int64(end - start + 1),
+		}, nil
+	}
+}
+
 func splitterStub(ctx context.Context) Splitter {
 	testURL, _ := url.ParseRequestURI("http://source.com/file.txt")
 
@@ -231,3 +392,153 @@ func splitterStub(ctx context.Context) Splitter {
 		client: &mockClient{},
 	}
 }
+
+// expiringResponder serves the content from the fresh URL and rejects the
+// expired one with the status.
+func expiringResponder(content, fresh string, status int) func(req *http.Request) (*http.Response, error) {
+	respond := rangeResponder(content)
+
+	return func(req *http.Request) (*http.Response, error) {
+		if req.URL.String() != fresh {
+			return &http.Response{
+				StatusCode: status,
+				Status:     http.StatusText(status),
+				Body:       ioutil.NopCloser(strings.NewReader("")),
+			}, nil
+		}
+
+		return respond(req)
+	}
+}
+
+func TestSplitterRefreshURL(t *testing.T) {
+	dir, f := initTmpStorage()
+	defer os.RemoveAll(dir)
+
+	path, _ := url.Parse("http://source.com/file.txt")
+	expired, _ := url.Parse("http://cdn.com/file.txt?sig=old")
+	fresh, _ := url.Parse("http://cdn.com/file.txt?sig=new")
+
+	GetDoFunc = expiringResponder("abcdefghijkl", fresh.String(), http.StatusForbidden)
+
+	var (
+		mu    sync.Mutex
+		calls int
+	)
+
+	src := &Source{Path: path, FinalURL: expired, Size: 12}
+	s := NewSplitter(context.Background(), &PathInfo{Source: src, Dest: f}, 3, &mockClient{})
+	s.RefreshURL = func(ctx context.Context, got *Source) (*url.URL, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		calls++
+		assert.Equal(t, src, got)
+
+		return fresh, nil
+	}
+
+	assert.NoError(t, s.Download())
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, fresh, src.FinalURL)
+
+	content, _ := ioutil.ReadFile(f.Name())
+	assert.Equal(t, "abcdefghijkl", string(content))
+}
+
+func TestSplitterRefreshURLRedirect(t *testing.T) {
+	dir, f := initTmpStorage()
+	defer os.RemoveAll(dir)
+
+	path, _ := url.Parse("http://source.com/file.txt")
+	expired, _ := url.Parse("http://cdn.com/file.txt?sig=old")
+	fresh, _ := url.Parse("http://cdn.com/file.txt?sig=new")
+
+	GetHeadFunc = func(u string) (*http.Response, error) {
+		assert.Equal(t, path.String(), u)
+
+		return &http.Response{
+			StatusCode:    200,
+			ContentLength: 12,
+			Request:       &http.Request{URL: fresh},
+		}, nil
+	}
+	GetDoFunc = expiringResponder("abcdefghijkl", fresh.String(), http.StatusGone)
+
+	src := &Source{Path: path, FinalURL: expired, Size: 12}
+	s := NewSplitter(context.Background(), &PathInfo{Source: src, Dest: f}, 2, &mockClient{})
+
+	assert.NoError(t, s.Download())
+	assert.Equal(t, fresh, src.FinalURL)
+}
+
+func TestSplitterRefreshURLManyChunks(t *testing.T) {
+	dir, f := initTmpStorage()
+	defer os.RemoveAll(dir)
+
+	content := strings.Repeat("abcdefghijklmnop", 16)
+	path, _ := url.Parse("http://source.com/file.txt")
+	expired, _ := url.Parse("http://cdn.com/file.txt?sig=old")
+	fresh, _ := url.Parse("http://cdn.com/file.txt?sig=new")
+
+	var (
+		mu     sync.Mutex
+		probes int
+	)
+
+	GetHeadFunc = func(u string) (*http.Response, error) {
+		mu.Lock()
+		probes++
+		mu.Unlock()
+
+		return &http.Response{
+			StatusCode:    200,
+			ContentLength: int64(len(content)),
+			Request:       &http.Request{URL: fresh},
+		}, nil
+	}
+	// All chunks get the expired URL before any of them refreshes it.
+	var expiredWG sync.WaitGroup
+	expiredWG.Add(16)
+
+	respond := expiringResponder(content, fresh.String(), http.StatusGone)
+	GetDoFunc = func(req *http.Request) (*http.Response, error) {
+		if req.URL.String() == expired.String() {
+			expiredWG.Done()
+			expiredWG.Wait()
+		}
+
+		return respond(req)
+	}
+
+	src := &Source{Path: path, FinalURL: expired, Size: len(content)}
+	s := NewSplitter(context.Background(), &PathInfo{Source: src, Dest: f}, 16, &mockClient{})
+	s.Workers = 16
+
+	assert.NoError(t, s.Download())
+	assert.Equal(t, 1, probes)
+
+	result, _ := ioutil.ReadFile(f.Name())
+	assert.Equal(t, content, string(result))
+}
+
+func TestSplitterRefreshURLError(t *testing.T) {
+	dir, f := initTmpStorage()
+	defer os.RemoveAll(dir)
+
+	path, _ := url.Parse("http://source.com/file.txt")
+
+	GetDoFunc = expiringResponder("abcdefghijkl", "", http.StatusForbidden)
+
+	s := NewSplitter(context.Background(), &PathInfo{Source: &Source{Path: path, Size: 12}, Dest: f}, 1, &mockClient{})
+	err := s.Download()
+	assert.EqualError(t, err, "splitter: response to bytes=0-11: unexpected status Forbidden")
+
+	s = NewSplitter(context.Background(), &PathInfo{Source: &Source{Path: path, Size: 12}, Dest: f}, 1, &mockClient{})
+	s.RefreshURL = func(ctx context.Context, src *Source) (*url.URL, error) {
+		return nil, errors.New("token revoked")
+	}
+
+	err = s.Download()
+	assert.EqualError(t, err, "splitter: cannot refresh source URL: token revoked")
+}
@@ -0,0 +1,256 @@
+package splitter
+
+import (
+	"io"
+	"sync"
+)
+
+// DefaultMaxBuffer is the memory ceiling used by Stream if
+// Splitter.MaxBuffer is zero.
+const DefaultMaxBuffer = 16 << 20
+
+// minBuffer is the smallest memory ceiling accepted by Stream. It must hold at
+// least one read of writeChunk.
+const minBuffer = 4 << 10
+
+// Stream downloads the source by chunks asynchronously and writes its bytes
+// strictly in order to w, which may be a pipe, a socket or any other
+// non-seekable writer. PathInfo.Dest is not used.
+//
+// Chunks that run ahead of the written part are kept in memory up to
+// MaxBuffer bytes. A worker whose data does not fit waits until the bytes
+// before it are written, so the memory use does not depend on the source size.
+//
+// Retries, rate limits, progress reports and response validation work the
+// same way as in Download, but there is no journal, so an interrupted stream
+// cannot be resumed. The checksums are computed over the written bytes and a
+// mismatch is reported after the last byte is written.
+func (s *Splitter) Stream(w io.Writer) error {
+	checksums := s.checksums()
+
+	var v *verifier
+	if len(checksums) > 0 {
+		var err error
+		if v, err = newVerifier(checksums); err != nil {
+			return err
+		}
+
+		w = io.MultiWriter(w, v)
+	}
+
+	s.stream = newOrderedWriter(w, s.PI.Source.Size, s.maxBuffer())
+	defer func() { s.stream = nil }()
+
+	s.journal = newJournal(
+		s.PI.Source,
+		nil,
+		NewRangeBuilder(s.PI.Source.Size, s.streamChunkCount(), 0),
+	)
+
+	if err := s.run(s.journal.Chunks); err != nil {
+		s.stream.fail(err)
+		_ = s.stream.wait()
+
+		return err
+	}
+
+	if err := s.stream.wait(); err != nil {
+		return &splitterError{context: "cannot write stream", err: err}
+	}
+
+	if v != nil {
+		return v.check()
+	}
+
+	return nil
+}
+
+// maxBuffer returns the memory ceiling of Stream.
+func (s *Splitter) maxBuffer() int {
+	switch {
+	case s.MaxBuffer == 0:
+		return DefaultMaxBuffer
+	case s.MaxBuffer < minBuffer:
+		return minBuffer
+	}
+
+	return s.MaxBuffer
+}
+
+// streamChunkCount returns the number of chunks for Stream. Chunks are made
+// small enough for every worker to keep its chunk within the memory ceiling.
+func (s *Splitter) streamChunkCount() int {
+	size := s.maxBuffer() / s.workerCount(s.ChunkCnt)
+	if size < 1 {
+		size = 1
+	}
+
+	n := (s.PI.Source.Size + size - 1) / size
+	if n < s.ChunkCnt {
+		return s.ChunkCnt
+	}
+
+	return n
+}
+
+// An orderedWriter collects the bytes written at arbitrary offsets into a ring
+// buffer and writes them to the underlying writer in order. WriteAt blocks
+// while the bytes do not fit into the buffer.
+type orderedWriter struct {
+	w    io.Writer
+	size int
+	buf  []byte
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	emitted int
+	filled  []DownloadRange
+	err     error
+	done    chan struct{}
+}
+
+// newOrderedWriter creates new orderedWriter instance that writes size bytes
+// to w and starts writing them.
+func newOrderedWriter(w io.Writer, size, bufSize int) *orderedWriter {
+	ow := &orderedWriter{
+		w:    w,
+		size: size,
+		buf:  make([]byte, bufSize),
+		done: make(chan struct{}),
+	}
+	ow.cond = sync.NewCond(&ow.mu)
+
+	go ow.emit()
+
+	return ow
+}
+
+// WriteAt stores p at the offset off. Bytes that were already written to the
+// underlying writer are discarded.
+func (ow *orderedWriter) WriteAt(p []byte, off int64) (int, error) {
+	ow.mu.Lock()
+	defer ow.mu.Unlock()
+
+	n := len(p)
+	start := int(off)
+
+	if start < ow.emitted {
+		if ow.emitted-start >= len(p) {
+			return n, nil
+		}
+
+		p = p[ow.emitted-start:]
+		start = ow.emitted
+	}
+
+	for ow.err == nil && start+len(p) > ow.emitted+len(ow.buf) {
+		ow.cond.Wait()
+	}
+
+	if ow.err != nil {
+		return 0, ow.err
+	}
+
+	for i := 0; i < len(p); {
+		i += copy(ow.buf[(start+i)%len(ow.buf):], p[i:])
+	}
+
+	ow.fill(DownloadRange{Start: start, End: start + len(p)})
+	ow.cond.Broadcast()
+
+	return n, nil
+}
+
+// fill adds the range to the sorted list of filled ranges and merges the
+// adjacent ones. ow.mu must be held.
+func (ow *orderedWriter) fill(dr DownloadRange) {
+	i := 0
+	for i < len(ow.filled) && ow.filled[i].End < dr.Start {
+		i++
+	}
+
+	j := i
+	for j < len(ow.filled) && ow.filled[j].Start <= dr.End {
+		if ow.filled[j].Start < dr.Start {
+			dr.Start = ow.filled[j].Start
+		}
+
+		if ow.filled[j].End > dr.End {
+			dr.End = ow.filled[j].End
+		}
+		j++
+	}
+
+	ow.filled = append(ow.filled[:i], append([]DownloadRange{dr}, ow.filled[j:]...)...)
+}
+
+// emit writes the contiguous bytes following the written part until all bytes
+// are written or the writer fails.
+func (ow *orderedWriter) emit() {
+	defer close(ow.done)
+
+	ow.mu.Lock()
+	defer ow.mu.Unlock()
+
+	for {
+		for ow.err == nil && ow.emitted < ow.size &&
+			(len(ow.filled) == 0 || ow.filled[0].Start > ow.emitted) {
+			ow.cond.Wait()
+		}
+
+		if ow.err != nil || ow.emitted >= ow.size {
+			return
+		}
+
+		pos := ow.emitted % len(ow.buf)
+		n := ow.filled[0].End - ow.emitted
+		if n > len(ow.buf)-pos {
+			n = len(ow.buf) - pos
+		}
+
+		ow.mu.Unlock()
+		_, err := ow.w.Write(ow.buf[pos : pos+n])
+		ow.mu.Lock()
+
+		if err != nil {
+			if ow.err == nil {
+				ow.err = err
+			}
+			ow.cond.Broadcast()
+
+			return
+		}
+
+		ow.emitted += n
+		if ow.filled[0].End <= ow.emitted {
+			ow.filled = ow.filled[1:]
+		}
+		ow.cond.Broadcast()
+	}
+}
+
+// fail stops the writer, so blocked and further WriteAt calls return err.
+// It is safe to call on nil receiver.
+func (ow *orderedWriter) fail(err error) {
+	if ow == nil {
+		return
+	}
+
+	ow.mu.Lock()
+	defer ow.mu.Unlock()
+
+	if ow.err == nil {
+		ow.err = err
+	}
+	ow.cond.Broadcast()
+}
+
+// wait waits until the writer is finished and returns its error.
+func (ow *orderedWriter) wait() error {
+	<-ow.done
+
+	ow.mu.Lock()
+	defer ow.mu.Unlock()
+
+	return ow.err
+}
@@ -0,0 +1,165 @@
+package splitter
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestOrderedWriter(t *testing.T) {
+	var out bytes.Buffer
+	ow := newOrderedWriter(&out, 10, 4)
+
+	var wg sync.WaitGroup
+	for _, w := range []struct {
+		off  int64
+		data string
+	}{{6, "ghij"}, {3, "def"}, {0, "abc"}} {
+		wg.Add(1)
+		go func(off int64, data string) {
+			defer wg.Done()
+			for i := 0; i < len(data); i += 2 {
+				end := i + 2
+				if end > len(data) {
+					end = len(data)
+				}
+
+				_, err := ow.WriteAt([]byte(data[i:end]), off+int64(i))
+				assert.NoError(t, err)
+			}
+		}(w.off, w.data)
+	}
+
+	wg.Wait()
+	assert.NoError(t, ow.wait())
+	assert.Equal(t, "abcdefghij", out.String())
+
+	n, err := ow.WriteAt([]byte("ab"), 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+}
+
+func TestOrderedWriterFail(t *testing.T) {
+	ow := newOrderedWriter(ioutil.Discard, 10, 4)
+
+	done := make(chan error)
+	go func() {
+		_, err := ow.WriteAt([]byte("ghij"), 6)
+		done <- err
+	}()
+
+	ow.fail(errors.New("chunk failed"))
+	assert.EqualError(t, <-done, "chunk failed")
+	assert.EqualError(t, ow.wait(), "chunk failed")
+}
+
+func TestSplitterStream(t *testing.T) {
+	testURL, _ := url.ParseRequestURI("http://source.com/file.txt")
+	content := strings.Repeat("0123456789abcdef", 1024)
+	respond := rangeResponder(content)
+
+	GetDoFunc = func(req *http.Request) (*http.Response, error) {
+		if strings.HasPrefix(req.Header.Get("Range"), "bytes=0-") {
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		return respond(req)
+	}
+
+	sum := sha256.Sum256([]byte(content))
+
+	s := NewSplitter(
+		context.Background(),
+		&PathInfo{Source: &Source{Path: testURL, Size: len(content)}},
+		2,
+		&mockClient{},
+	)
+	s.Workers = 4
+	s.MaxBuffer = minBuffer * 2
+	s.Checksum = &Checksum{Algorithm: SHA256, Sum: sum[:]}
+
+	var out bytes.Buffer
+	assert.NoError(t, s.Stream(&out))
+	assert.Equal(t, content, out.String())
+	assert.Nil(t, s.PI.Dest)
+}
+
+func TestSplitterStreamChunkError(t *testing.T) {
+	testURL, _ := url.ParseRequestURI("http://source.com/file.txt")
+	content := strings.Repeat("x", 4*minBuffer)
+	respond := rangeResponder(content)
+
+	GetDoFunc = func(req *http.Request) (*http.Response, error) {
+		if strings.HasPrefix(req.Header.Get("Range"), "bytes=0-") {
+			return nil, errors.New("connection reset")
+		}
+
+		return respond(req)
+	}
+
+	s := NewSplitter(
+		context.Background(),
+		&PathInfo{Source: &Source{Path: testURL, Size: len(content)}},
+		4,
+		&mockClient{},
+	)
+	s.MaxBuffer = minBuffer
+
+	var out bytes.Buffer
+	assert.EqualError(
+		t,
+		s.Stream(&out),
+		"splitter: chunk download error: connection reset",
+	)
+	assert.Empty(t, out.String())
+}
+
+func TestSplitterStreamFallback(t *testing.T) {
+	testURL, _ := url.ParseRequestURI("http://source.com/file.txt")
+
+	GetDoFunc = func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode:    200,
+			Body:          ioutil.NopCloser(strings.NewReader("abcdefghijkl")),
+			ContentLength: 12,
+		}, nil
+	}
+
+	s := NewSplitter(
+		context.Background(),
+		&PathInfo{Source: &Source{Path: testURL, Size: 12}},
+		3,
+		&mockClient{},
+	)
+
+	var out bytes.Buffer
+	assert.NoError(t, s.Stream(&out))
+	assert.Equal(t, "abcdefghijkl", out.String())
+}
+
+func TestSplitterStreamVerificationError(t *testing.T) {
+	testURL, _ := url.ParseRequestURI("http://source.com/file.txt")
+	GetDoFunc = rangeResponder("abcdef")
+
+	s := NewSplitter(
+		context.Background(),
+		&PathInfo{Source: &Source{Path: testURL, Size: 6}},
+		2,
+		&mockClient{},
+	)
+	s.Checksum = &Checksum{Algorithm: SHA256, Sum: make([]byte, 32)}
+
+	var out bytes.Buffer
+	var ve *VerificationError
+	assert.True(t, errors.As(s.Stream(&out), &ve))
+	assert.Equal(t, "abcdef", out.String())
+}